@@ -18,7 +18,10 @@ func New() *cli.App {
 		&cli.StringFlag{Name: "git-password", Value: "", Usage: "git password", Required: false},
 		altsrc.NewStringFlag(&cli.StringFlag{Name: "git-url", Usage: "git url to clone", Required: false}),
 		altsrc.NewStringFlag(&cli.StringFlag{Name: "git-branch", Value: "master", Usage: "git branch to run syncing on"}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "git-branches", Usage: "git branches or globs such as env/* to sync, each under its own consul path. Overrides git-branch"}),
+		altsrc.NewStringFlag(&cli.StringFlag{Name: "branch-prefix", Usage: "template of the consul path of a branch under consul-path such as {{.Repo}}/{{.Branch}}, defaults to {{.Branch}} when several branches are synced"}),
 		altsrc.NewStringFlag(&cli.StringFlag{Name: "git-dir", Value: "/var/git2consul/data", Usage: "directory to pull to"}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{Name: "git-bare", Usage: "clone the repository without a working tree, contents are always read from the commits"}),
 		altsrc.NewStringFlag(&cli.StringFlag{Name: "git-ssh-publickey-path", Usage: "public key for ssh agent"}),
 		altsrc.NewStringFlag(&cli.StringFlag{Name: "git-ssh-privatekey-path", Usage: "private key for ssh agent"}),
 		altsrc.NewStringFlag(&cli.StringFlag{Name: "git-ssh-passphrase-path", Usage: "passpharse for sshkey"}),
@@ -27,6 +30,22 @@ func New() *cli.App {
 		altsrc.NewStringFlag(&cli.StringFlag{Name: "git-fingerprint-path", FilePath: "/var/git2consul/.ssh/fingerprint", Usage: "git RSA finerprint id", Required: false}),
 		altsrc.NewStringFlag(&cli.StringFlag{Name: "consul-addr", Value: "localhost:8500", EnvVars: []string{"CONSUL_ADDR"}, Usage: "consul address to write to. Will use agent unless an env is set of CONSUL_ADDR"}),
 		altsrc.NewStringFlag(&cli.StringFlag{Name: "consul-path", Value: "", Usage: "consul path to sync "}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{Name: "expand-keys", Usage: "write each field of json, yaml, toml and properties files as its own consul key"}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "include", Usage: "only sync files matching these globs in gitignore syntax such as config/**"}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "exclude", Usage: "do not sync files matching these globs in gitignore syntax such as *.md, on top of the .git2consulignore file of the repository"}),
+		altsrc.NewStringFlag(&cli.StringFlag{Name: "source-root", Usage: "only sync files under this folder of the repository, to mountpoint"}),
+		altsrc.NewStringFlag(&cli.StringFlag{Name: "mountpoint", Usage: "consul path under consul-path that the files of source-root sync to"}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "mapping", Usage: "source_root=mountpoint pairs that each sync a folder of the repository to a path under consul-path, files outside every source root are skipped"}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "key-strip-extension", Usage: "extensions stripped from file names when building keys, * strips any extension"}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "key-rewrite", Usage: "pattern=>replacement regular expression rewrites of keys, applied in order"}),
+		altsrc.NewBoolFlag(&cli.BoolFlag{Name: "key-split-dots", Usage: "turn the dots of file names into folders, db.host becomes db/host"}),
+		altsrc.NewStringFlag(&cli.StringFlag{Name: "key-case", Usage: "lower or upper case keys"}),
+		altsrc.NewStringFlag(&cli.StringFlag{Name: "normalize", Value: "trim", Usage: "how file contents are normalized before they are written: raw, trim, trim-trailing-newline, crlf or base64, which encodes binary files"}),
+		altsrc.NewStringSliceFlag(&cli.StringSliceFlag{Name: "normalize-rule", Usage: "glob=policy pairs that normalize matching files with another policy, the last matching rule wins"}),
+		altsrc.NewStringFlag(&cli.StringFlag{Name: "txn-policy", Value: "reject", Usage: "how changes larger than one consul transaction of 64 operations are applied, reject refuses them so consul always matches a commit, split applies them as consecutive transactions that other clients can see half applied [reject, split]"}),
+		altsrc.NewStringFlag(&cli.StringFlag{Name: "require-signatures", Usage: "refuse commits without a trusted gpg or ssh signature, tip verifies only the head commit, all verifies every commit being applied including merged ones [tip, all]"}),
+		altsrc.NewStringFlag(&cli.StringFlag{Name: "gpg-keyring", Usage: "armored or binary gpg keyring of the keys trusted to sign commits"}),
+		altsrc.NewStringFlag(&cli.StringFlag{Name: "ssh-allowed-signers", Usage: "ssh allowed signers file of the keys trusted to sign commits"}),
 		&cli.StringFlag{Name: "consul-token", Value: "somestillytoken", EnvVars: []string{"CONSUL_TOKEN"}, Usage: "consul address to write to. Will use agent unless an env is set of CONSUL_TOKEN"},
 		altsrc.NewBoolFlag(&cli.BoolFlag{Name: "metrics", Usage: "send metrics to pushgateway", EnvVars: []string{"GIT2CONSUL_METRICS"}, Hidden: true}),
 		altsrc.NewStringFlag(&cli.StringFlag{Name: "metrics-port", Value: "2112", EnvVars: []string{"GIT2CONSUL_METRICS_PORT"}}),
@@ -49,6 +68,6 @@ func New() *cli.App {
 		}
 		return nil
 	}
-	app.Commands = []*cli.Command{&operatorCommand, &syncCommand, &resyncCommand}
+	app.Commands = []*cli.Command{&operatorCommand, &syncCommand, &resyncCommand, &planCommand, &rollbackCommand, &approveRewriteCommand, &driftCommand, &exportCommand}
 	return app
 }
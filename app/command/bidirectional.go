@@ -0,0 +1,233 @@
+package command
+
+import (
+	"bytes"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"git2consul/consul"
+	"git2consul/expand"
+	"git2consul/git"
+
+	"github.com/hashicorp/consul/api"
+	git2go "github.com/libgit2/git2go/v29"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+//applied maps the keys of an applied commit to the files they come from
+type applied struct {
+	commit string
+	// values of every key the commit syncs
+	values map[string][]byte
+	// owners of every key
+	owners map[string]string
+	// keys of every file
+	files map[string]map[string][]byte
+}
+
+//readApplied computes the keys a commit syncs for a branch. The values are normalized the way they
+//were written according to the sync state, a nil state means they were written as configured
+func readApplied(b *branch, gitCollection *git.Collection, commit string, state *consul.State) (*applied, error) {
+	diffs, err := gitCollection.Diff("", commit)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := b.repo.loadFilter(gitCollection, commit)
+	if err != nil {
+		return nil, err
+	}
+	if state != nil {
+		recorded := *b
+		if recorded.normalization, err = recordedNormalization(state); err != nil {
+			return nil, err
+		}
+		b = &recorded
+	}
+	a := &applied{commit: commit, values: map[string][]byte{}, owners: map[string]string{}, files: map[string]map[string][]byte{}}
+	for _, diff := range diffs {
+		key, mapped := b.key(diff.NewFile)
+		if !diff.NewIsFile() || !mapped || !filter.allows(diff.NewFile) {
+			continue
+		}
+		keys := fileKeys(b, key, diff.NewFile, gitCollection.ReadBlob(diff.NewID))
+		a.files[diff.NewFile] = keys
+		for key, value := range keys {
+			a.values[key] = value
+			a.owners[key] = diff.NewFile
+		}
+	}
+	return a, nil
+}
+
+//expanded tells whether a file was synced as a key per field
+func (a *applied) expanded(b *branch, file string) bool {
+	keys := a.files[file]
+	fileKey, _ := b.key(file)
+	_, whole := keys[fileKey]
+	return !(len(keys) == 1 && whole)
+}
+
+//listManaged returns the pairs under the consul path of a branch that a file can write
+func listManaged(b *branch, consulInteractor *consul.ConsulHandler) (map[string]*api.KVPair, error) {
+	prefix := consulPrefix(b.prefix)
+	kvPairs, err := consulInteractor.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	pairs := make(map[string]*api.KVPair, len(kvPairs))
+	for _, kvPair := range kvPairs {
+		if managedKey(b.prefix, kvPair.Key) {
+			pairs[kvPair.Key] = kvPair
+		}
+	}
+	return pairs, nil
+}
+
+//consulEdits returns the file writes and deletes that bring the applied commit in line with consul. Files that
+//were expanded are encoded again from their keys, which needs an encoder for their extension
+func consulEdits(b *branch, a *applied, pairs map[string]*api.KVPair) (map[string][]byte, []string) {
+	changed := map[string]bool{}
+	for key, value := range a.values {
+		if pair, ok := pairs[key]; !ok || !bytes.Equal(pair.Value, value) {
+			changed[a.owners[key]] = true
+		}
+	}
+	writes := map[string][]byte{}
+	for key, pair := range pairs {
+		if _, ok := a.values[key]; ok {
+			continue
+		}
+		if file := a.expandedOwner(b, key); file != "" {
+			changed[file] = true
+			continue
+		}
+		file, mapped := b.path(key)
+		if !mapped || !exportablePath(file) {
+			logrus.WithField("key", key).Warning("key added in consul does not map to a repository path, not committing it")
+			continue
+		}
+		writes[file] = append([]byte{}, pair.Value...)
+	}
+	var deletes []string
+	for file := range changed {
+		fileKey, _ := b.key(file)
+		if !a.expanded(b, file) {
+			if pair, ok := pairs[fileKey]; ok {
+				writes[file] = append([]byte{}, pair.Value...)
+			} else {
+				deletes = append(deletes, file)
+			}
+			continue
+		}
+		keys := map[string][]byte{}
+		for key, pair := range pairs {
+			if strings.HasPrefix(key, fileKey+"/") {
+				keys[strings.TrimPrefix(key, fileKey+"/")] = pair.Value
+			}
+		}
+		if len(keys) == 0 {
+			deletes = append(deletes, file)
+			continue
+		}
+		encode, ok := expand.EncoderFor(path.Ext(file))
+		if !ok {
+			logrus.WithField("file", file).Warning("no encoder for the expanded file, not committing its consul edits")
+			continue
+		}
+		contents, err := encode(keys)
+		if err != nil {
+			logrus.WithError(err).WithField("file", file).Warning("failed encoding consul edits of the expanded file")
+			continue
+		}
+		writes[file] = contents
+	}
+	sort.Strings(deletes)
+	return writes, deletes
+}
+
+//expandedOwner returns the expanded file a key added in consul falls under
+func (a *applied) expandedOwner(b *branch, key string) string {
+	for file := range a.files {
+		fileKey, _ := b.key(file)
+		if a.expanded(b, file) && strings.HasPrefix(key, fileKey+"/") {
+			return file
+		}
+	}
+	return ""
+}
+
+//captureEdits commits the consul edits of a branch on top of the applied commit to its edits branch and pushes it
+func captureEdits(c *cli.Context, b *branch, gitCollection *git.Collection, a *applied, pairs map[string]*api.KVPair) error {
+	writes, deletes := consulEdits(b, a, pairs)
+	if len(writes) == 0 && len(deletes) == 0 {
+		return nil
+	}
+	editsBranch := c.String("edits-branch-prefix") + b.name
+	commit, err := gitCollection.CommitFiles(editsBranch, a.commit, writes, deletes, "Capture consul edits under "+consulKey(b.prefix, ""), &git2go.Signature{
+		Name:  "git2consul",
+		Email: "git2consul@localhost",
+		When:  time.Now(),
+	})
+	if err == git.ErrNoChanges {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	logrus.WithFields(logrus.Fields{
+		"branch":  editsBranch,
+		"commit":  commit,
+		"writes":  len(writes),
+		"deletes": len(deletes),
+	}).Info("committed consul edits")
+	return gitCollection.Push(b.repo.cloneOptions(), b.repo.Remote, editsBranch, true)
+}
+
+//casGroups guards the groups of a sync with the ModifyIndex consul has for their keys so concurrent edits roll
+//the transaction back. Groups touching keys whose consul value no longer matches the applied commit, because
+//they were edited, added or deleted in consul, are left out and their keys returned as conflicts
+func casGroups(groups []api.KVTxnOps, a *applied, pairs map[string]*api.KVPair) ([]api.KVTxnOps, []string) {
+	var guarded []api.KVTxnOps
+	var conflicts []string
+	for _, group := range groups {
+		var cas api.KVTxnOps
+		var groupConflicts []string
+		for _, op := range group {
+			pair, exists := pairs[op.Key]
+			appliedValue, wasApplied := a.values[op.Key]
+			switch {
+			case exists && op.Verb == api.KVSet && bytes.Equal(pair.Value, op.Value):
+				// consul already has the value git wants
+			case exists && !(wasApplied && bytes.Equal(pair.Value, appliedValue)):
+				// edited or added in consul
+				groupConflicts = append(groupConflicts, op.Key)
+			case !exists && wasApplied:
+				// deleted in consul
+				if op.Verb == api.KVSet {
+					groupConflicts = append(groupConflicts, op.Key)
+				}
+				continue
+			}
+			switch {
+			case op.Verb == api.KVSet && exists:
+				cas = append(cas, &api.KVTxnOp{Verb: api.KVCAS, Key: op.Key, Value: op.Value, Flags: op.Flags, Index: pair.ModifyIndex})
+			case op.Verb == api.KVSet:
+				cas = append(cas, &api.KVTxnOp{Verb: api.KVCAS, Key: op.Key, Value: op.Value, Flags: op.Flags})
+			case op.Verb == api.KVDelete && exists:
+				cas = append(cas, &api.KVTxnOp{Verb: api.KVDeleteCAS, Key: op.Key, Index: pair.ModifyIndex})
+			}
+		}
+		if len(groupConflicts) > 0 {
+			conflicts = append(conflicts, groupConflicts...)
+			continue
+		}
+		if len(cas) > 0 {
+			guarded = append(guarded, cas)
+		}
+	}
+	sort.Strings(conflicts)
+	return guarded, conflicts
+}
@@ -0,0 +1,254 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+
+	"git2consul/consul"
+
+	"github.com/hashicorp/consul/api"
+)
+
+//testApplied returns an applied commit syncing each file to the key of the same path under app
+func testApplied(commit string, files map[string]string) *applied {
+	a := &applied{commit: commit, values: map[string][]byte{}, owners: map[string]string{}, files: map[string]map[string][]byte{}}
+	for file, value := range files {
+		key := "app/" + file
+		a.values[key] = []byte(value)
+		a.owners[key] = file
+		a.files[file] = map[string][]byte{key: []byte(value)}
+	}
+	return a
+}
+
+func TestCasGroups(t *testing.T) {
+	a := testApplied("", map[string]string{"a": "1"})
+	set := &api.KVTxnOp{Verb: api.KVSet, Key: "app/a", Value: []byte("2"), Flags: consul.WriteFlag}
+	remove := &api.KVTxnOp{Verb: api.KVDelete, Key: "app/a"}
+	add := &api.KVTxnOp{Verb: api.KVSet, Key: "app/b", Value: []byte("2"), Flags: consul.WriteFlag}
+	tests := []struct {
+		name     string
+		op       *api.KVTxnOp
+		pairs    map[string]*api.KVPair
+		conflict bool
+		verb     api.KVOp
+		index    uint64
+	}{
+		{
+			name:  "unchanged key is written",
+			op:    set,
+			pairs: map[string]*api.KVPair{"app/a": {Key: "app/a", Value: []byte("1"), Flags: consul.WriteFlag, ModifyIndex: 3}},
+			verb:  api.KVCAS,
+			index: 3,
+		},
+		{
+			name:     "edit that keeps the flag conflicts",
+			op:       set,
+			pairs:    map[string]*api.KVPair{"app/a": {Key: "app/a", Value: []byte("edited"), Flags: consul.WriteFlag, ModifyIndex: 4}},
+			conflict: true,
+		},
+		{
+			name:     "edit without the flag conflicts",
+			op:       set,
+			pairs:    map[string]*api.KVPair{"app/a": {Key: "app/a", Value: []byte("edited"), ModifyIndex: 4}},
+			conflict: true,
+		},
+		{
+			name:  "consul already has the new value",
+			op:    set,
+			pairs: map[string]*api.KVPair{"app/a": {Key: "app/a", Value: []byte("2"), ModifyIndex: 4}},
+			verb:  api.KVCAS,
+			index: 4,
+		},
+		{
+			name:     "key deleted in consul conflicts with a write",
+			op:       set,
+			pairs:    map[string]*api.KVPair{},
+			conflict: true,
+		},
+		{
+			name:  "key deleted in consul and in git",
+			op:    remove,
+			pairs: map[string]*api.KVPair{},
+		},
+		{
+			name:  "unchanged key is deleted",
+			op:    remove,
+			pairs: map[string]*api.KVPair{"app/a": {Key: "app/a", Value: []byte("1"), ModifyIndex: 3}},
+			verb:  api.KVDeleteCAS,
+			index: 3,
+		},
+		{
+			name:     "key added in consul conflicts",
+			op:       add,
+			pairs:    map[string]*api.KVPair{"app/b": {Key: "app/b", Value: []byte("consul"), Flags: consul.WriteFlag, ModifyIndex: 5}},
+			conflict: true,
+		},
+		{
+			name:  "new key is created",
+			op:    add,
+			pairs: map[string]*api.KVPair{},
+			verb:  api.KVCAS,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			guarded, conflicts := casGroups([]api.KVTxnOps{{test.op}}, a, test.pairs)
+			if test.conflict {
+				if !reflect.DeepEqual(conflicts, []string{test.op.Key}) || len(guarded) != 0 {
+					t.Errorf("expected %s to conflict, got conflicts %v and %d groups", test.op.Key, conflicts, len(guarded))
+				}
+				return
+			}
+			if len(conflicts) != 0 {
+				t.Fatalf("expected no conflicts, got %v", conflicts)
+			}
+			if test.verb == "" {
+				if len(guarded) != 0 {
+					t.Errorf("expected no operations, got %d groups", len(guarded))
+				}
+				return
+			}
+			if len(guarded) != 1 || len(guarded[0]) != 1 {
+				t.Fatalf("expected a single operation, got %v", guarded)
+			}
+			if op := guarded[0][0]; op.Verb != test.verb || op.Index != test.index {
+				t.Errorf("expected %s at index %d, got %s at index %d", test.verb, test.index, op.Verb, op.Index)
+			}
+		})
+	}
+}
+
+func TestConsulEdits(t *testing.T) {
+	b := testBranch(t, &repoConfig{}, "app")
+	expanded := testApplied("", map[string]string{"a": "1"})
+	expanded.files["config.json"] = map[string][]byte{"app/config.json/host": []byte("localhost")}
+	expanded.values["app/config.json/host"] = []byte("localhost")
+	expanded.owners["app/config.json/host"] = "config.json"
+	tests := []struct {
+		name    string
+		applied *applied
+		pairs   map[string]*api.KVPair
+		writes  map[string]string
+		deletes []string
+	}{
+		{
+			name:    "no edits",
+			applied: testApplied("", map[string]string{"a": "1"}),
+			pairs:   map[string]*api.KVPair{"app/a": {Key: "app/a", Value: []byte("1")}},
+			writes:  map[string]string{},
+		},
+		{
+			name:    "edited key",
+			applied: testApplied("", map[string]string{"a": "1"}),
+			pairs:   map[string]*api.KVPair{"app/a": {Key: "app/a", Value: []byte("2"), Flags: consul.WriteFlag}},
+			writes:  map[string]string{"a": "2"},
+		},
+		{
+			name:    "deleted key",
+			applied: testApplied("", map[string]string{"a": "1", "b": "2"}),
+			pairs:   map[string]*api.KVPair{"app/a": {Key: "app/a", Value: []byte("1")}},
+			writes:  map[string]string{},
+			deletes: []string{"b"},
+		},
+		{
+			name:    "added key",
+			applied: testApplied("", map[string]string{"a": "1"}),
+			pairs: map[string]*api.KVPair{
+				"app/a":     {Key: "app/a", Value: []byte("1")},
+				"app/dir/c": {Key: "app/dir/c", Value: []byte("3")},
+			},
+			writes: map[string]string{"dir/c": "3"},
+		},
+		{
+			name:    "edited field of an expanded file",
+			applied: expanded,
+			pairs: map[string]*api.KVPair{
+				"app/a":                {Key: "app/a", Value: []byte("1")},
+				"app/config.json/host": {Key: "app/config.json/host", Value: []byte("db")},
+			},
+			writes: map[string]string{"config.json": "{\n  \"host\": \"db\"\n}\n"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writes, deletes := consulEdits(b, test.applied, test.pairs)
+			got := map[string]string{}
+			for file, contents := range writes {
+				got[file] = string(contents)
+			}
+			if !reflect.DeepEqual(got, test.writes) {
+				t.Errorf("expected writes %v, got %v", test.writes, got)
+			}
+			if !reflect.DeepEqual(deletes, test.deletes) {
+				t.Errorf("expected deletes %v, got %v", test.deletes, deletes)
+			}
+		})
+	}
+}
+
+func TestCaptureEdits(t *testing.T) {
+	tests := []struct {
+		name     string
+		pairs    map[string]*api.KVPair
+		captured string
+	}{
+		{
+			name:  "nothing edited",
+			pairs: map[string]*api.KVPair{"app/a": {Key: "app/a", Value: []byte("1")}},
+		},
+		{
+			name:     "edited key",
+			pairs:    map[string]*api.KVPair{"app/a": {Key: "app/a", Value: []byte("2"), Flags: consul.WriteFlag}},
+			captured: "2",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			remote, cleanupRemote := newTestRepo(t, true)
+			defer cleanupRemote()
+			local, cleanupLocal := newTestRepo(t, false)
+			defer cleanupLocal()
+			if _, err := local.Remotes.Create("origin", remote.dir); err != nil {
+				t.Fatal(err)
+			}
+			commit := local.commit(map[string]string{"a": "1"}, nil, "test")
+
+			c := testContext(map[string]string{"edits-branch-prefix": "git2consul-edits/"})
+			b := testBranch(t, &repoConfig{Remote: "origin"}, "app")
+			a := testApplied(commit, map[string]string{"a": "1"})
+			if err := captureEdits(c, b, local.collection(), a, test.pairs); err != nil {
+				t.Fatal(err)
+			}
+
+			ref, err := remote.References.Lookup("refs/heads/git2consul-edits/main")
+			if test.captured == "" {
+				if err == nil {
+					t.Error("expected no edits branch to be pushed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected the edits branch to be pushed: %v", err)
+			}
+			captured, err := remote.LookupCommit(ref.Target())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if captured.ParentCount() != 1 || captured.ParentId(0).String() != commit {
+				t.Errorf("expected the edits to be committed on top of %s", commit)
+			}
+			tree, err := captured.Tree()
+			if err != nil {
+				t.Fatal(err)
+			}
+			blob, err := remote.LookupBlob(tree.EntryByName("a").Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(blob.Contents()) != test.captured {
+				t.Errorf("expected a to be committed as %q, got %q", test.captured, blob.Contents())
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"git2consul/consul"
+	"git2consul/git"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+var driftCommand = cli.Command{
+	Name:        "drift",
+	Usage:       "compare consul with the commit applied to it",
+	ArgsUsage:   "[flags]",
+	Description: "compare every key under consul-path with the files of the commit recorded in consul and report modified, missing and extra keys. Exits with 0 when there is no drift, 2 when there is drift and 1 on errors",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "format", Value: "text", Usage: "output format [text, json]"},
+		&cli.BoolFlag{Name: "heal", Usage: "restore modified and missing keys to their values in git"},
+		&cli.BoolFlag{Name: "heal-extra", Usage: "with heal also delete extra keys no file in git syncs to"},
+	},
+	Action: func(c *cli.Context) error {
+		setLog(c)
+		// keep stdout for the report itself
+		logrus.SetOutput(os.Stderr)
+		defer func() {
+			if c.Bool("metrics") {
+				pushMetrics(c.String("pushgateway-addr"))
+			}
+		}()
+		b, err := repoFromFlags(c).branch(c.String("git-branch"))
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		repo := b.repo.open()
+		if repo == nil {
+			return cli.Exit("could not intialize the repo", 1)
+		}
+		consulInteractor, err := consul.NewHandler(consul.Config(c.String("consul-addr"), c.String("consul-token")))
+		if err != nil {
+			consulGitConnectionFailed.Inc()
+			return cli.Exit(err.Error(), 1)
+		}
+		report, err := checkDrift(b, repo, consulInteractor)
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		switch c.String("format") {
+		case "json":
+			encoder := json.NewEncoder(c.App.Writer)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(report)
+		case "text":
+			err = report.write(c.App.Writer)
+		default:
+			return cli.Exit(fmt.Sprintf("unknown format %q", c.String("format")), 1)
+		}
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		report.record()
+		if c.Bool("heal") {
+			if err := heal(c, consulInteractor, report, c.Bool("heal-extra")); err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			return nil
+		}
+		if len(report.Drifts) > 0 {
+			return cli.Exit("", 2)
+		}
+		return nil
+	},
+}
+
+//driftReport lists the keys under a consul path that differ from the applied commit
+type driftReport struct {
+	Commit     string   `json:"commit"`
+	ConsulPath string   `json:"consul_path"`
+	Drifts     []*drift `json:"drifts"`
+}
+
+//drift of a single consul key
+type drift struct {
+	Kind     string `json:"kind"`
+	Key      string `json:"key"`
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+}
+
+const (
+	driftModified = "modified"
+	driftMissing  = "missing"
+	driftExtra    = "extra"
+)
+
+//checkDrift compares the keys under the consul path of a branch with the files of the commit recorded in its sync state
+func checkDrift(b *branch, gitCollection *git.Collection, consulInteractor *consul.ConsulHandler) (*driftReport, error) {
+	state, err := consulInteractor.ReadState(stateKey(b.prefix))
+	if err != nil {
+		return nil, err
+	}
+	if state == nil {
+		return nil, errors.New("consul has no applied commit to compare with, run a resync first")
+	}
+	if b.name != "" && state.Branch != "" && state.Branch != b.name {
+		return nil, errors.Errorf("%s holds branch %s rather than %s", b.prefix, state.Branch, b.name)
+	}
+	a, err := readApplied(b, gitCollection, state.Commit, state)
+	if err != nil {
+		return nil, err
+	}
+	expected := a.values
+	prefix := consulPrefix(b.prefix)
+	kvPairs, err := consulInteractor.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	report := &driftReport{Commit: state.Commit, ConsulPath: b.prefix}
+	actual := make(map[string]bool, len(kvPairs))
+	for _, kvPair := range kvPairs {
+		actual[kvPair.Key] = true
+		value, ok := expected[kvPair.Key]
+		switch {
+		case ok && string(value) != string(kvPair.Value):
+			report.Drifts = append(report.Drifts, &drift{Kind: driftModified, Key: kvPair.Key, Expected: string(value), Actual: string(kvPair.Value)})
+		case !ok && prefix != "" && managedKey(b.prefix, kvPair.Key):
+			// without a consul path every key in consul would be extra
+			report.Drifts = append(report.Drifts, &drift{Kind: driftExtra, Key: kvPair.Key, Actual: string(kvPair.Value)})
+		}
+	}
+	for key, value := range expected {
+		if !actual[key] {
+			report.Drifts = append(report.Drifts, &drift{Kind: driftMissing, Key: key, Expected: string(value)})
+		}
+	}
+	sort.Slice(report.Drifts, func(i, j int) bool { return report.Drifts[i].Key < report.Drifts[j].Key })
+	return report, nil
+}
+
+//counts returns the number of drifted keys of every kind
+func (r *driftReport) counts() map[string]int {
+	counts := map[string]int{driftModified: 0, driftMissing: 0, driftExtra: 0}
+	for _, drift := range r.Drifts {
+		counts[drift.Kind]++
+	}
+	return counts
+}
+
+//record logs every drifted key and sets the drift gauges
+func (r *driftReport) record() {
+	for _, drift := range r.Drifts {
+		logrus.WithFields(logrus.Fields{
+			"kind":   drift.Kind,
+			"key":    drift.Key,
+			"commit": r.Commit,
+		}).Warning("consul key drifted from git")
+	}
+	for kind, count := range r.counts() {
+		consulGitDrift.WithLabelValues(kind, r.ConsulPath).Set(float64(count))
+	}
+}
+
+func (r *driftReport) write(w io.Writer) error {
+	for _, drift := range r.Drifts {
+		if _, err := fmt.Fprintf(w, "%-8s %s\n", drift.Kind, drift.Key); err != nil {
+			return err
+		}
+	}
+	if len(r.Drifts) == 0 {
+		_, err := fmt.Fprintf(w, "No drift. Consul matches %s.\n", r.Commit)
+		return err
+	}
+	counts := r.counts()
+	_, err := fmt.Fprintf(w, "\nDrift: %d modified, %d missing, %d extra.\n", counts[driftModified], counts[driftMissing], counts[driftExtra])
+	return err
+}
+
+//heal restores drifted keys to their values in git, extra keys are only deleted when extra is set
+func heal(c *cli.Context, consulInteractor *consul.ConsulHandler, report *driftReport, extra bool, guards ...*api.KVTxnOp) error {
+	var ops api.KVTxnOps
+	for _, drift := range report.Drifts {
+		switch {
+		case drift.Kind == driftExtra && extra:
+			ops = append(ops, &api.KVTxnOp{Verb: api.KVDelete, Key: drift.Key})
+		case drift.Kind != driftExtra:
+			ops = append(ops, &api.KVTxnOp{Verb: api.KVSet, Key: drift.Key, Value: []byte(drift.Expected), Flags: consul.WriteFlag})
+		}
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+	if err := consulInteractor.ApplyTxn(ops, consul.TxnPolicy(c.String("txn-policy")), guards...); err != nil {
+		consulGitSyncedFailed.Add(float64(len(ops)))
+		return errors.Wrap(err, "failed healing drift")
+	}
+	consulGitSynced.Add(float64(len(ops)))
+	logrus.WithFields(logrus.Fields{"keys": len(ops), "commit": report.Commit}).Info("healed drift")
+	return nil
+}
+
+//syncDrift reports the drift of a branch. Drift found on the interval is healed when drift-heal is set,
+//drift found after the watcher saw a foreign write is handled by the watch-policy
+func syncDrift(c *cli.Context, b *branch, gitCollection *git.Collection, consulInteractor *consul.ConsulHandler, guards api.KVTxnOps, watched bool) error {
+	report, err := checkDrift(b, gitCollection, consulInteractor)
+	if err != nil {
+		return err
+	}
+	report.record()
+	switch {
+	case watched && c.String("watch-policy") == watchRevert:
+		return heal(c, consulInteractor, report, true, guards...)
+	case watched:
+		return alert(consulInteractor, report)
+	case c.Bool("drift-heal"):
+		return heal(c, consulInteractor, report, false, guards...)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"git2consul/consul"
+	"git2consul/expand"
+	"git2consul/git"
+
+	"github.com/hashicorp/consul/api"
+	git2go "github.com/libgit2/git2go/v29"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+var exportCommand = cli.Command{
+	Name:        "export",
+	Usage:       "write consul keys into the repository and commit them",
+	ArgsUsage:   "--prefix <prefix>",
+	Description: "read every key under a prefix, write it as a file of git-dir with a folder per key segment and commit the files so the repository can take over the keys",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "prefix", Required: true, Usage: "consul prefix to export"},
+		&cli.StringFlag{Name: "compact", Usage: "compact the keys below compact-depth segments into one file per folder [yaml, json], sync them back with expand-keys"},
+		&cli.IntFlag{Name: "compact-depth", Value: 1, Usage: "number of key segments that stay folders and file names when compacting"},
+		&cli.StringFlag{Name: "message", Usage: "commit message, defaults to one naming the prefix"},
+		&cli.StringFlag{Name: "author-name", Value: "git2consul", Usage: "name of the commit author"},
+		&cli.StringFlag{Name: "author-email", Value: "git2consul@localhost", Usage: "email of the commit author"},
+		&cli.BoolFlag{Name: "push", Usage: "push the commit to git-branch of git-remote"},
+	},
+	Action: func(c *cli.Context) error {
+		setLog(c)
+		if c.String("compact") != "" && c.Int("compact-depth") < 1 {
+			return cli.Exit("compact-depth needs to be at least 1", 1)
+		}
+		repo := repoFromFlags(c)
+		gitCollection := repo.open()
+		if gitCollection == nil {
+			return cli.Exit("could not intialize the repo", 1)
+		}
+		if gitCollection.IsBare() {
+			return cli.Exit("export writes files to the working tree and does not work with a bare clone", 1)
+		}
+		gitCollection = repo.pull(gitCollection, c.String("git-branch"))
+		consulInteractor, err := consul.NewHandler(consul.Config(c.String("consul-addr"), c.String("consul-token")))
+		if err != nil {
+			consulGitConnectionFailed.Inc()
+			return cli.Exit(err.Error(), 1)
+		}
+		prefix := strings.Trim(c.String("prefix"), "/")
+		listPrefix := prefix
+		if listPrefix != "" {
+			listPrefix += "/"
+		}
+		kvPairs, err := consulInteractor.List(listPrefix)
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		files, err := exportFiles(kvPairs, prefix, c.String("compact"), c.Int("compact-depth"))
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		var paths []string
+		for path, contents := range files {
+			fullPath := filepath.Join(repo.Dir, filepath.FromSlash(path))
+			if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+				logrus.WithError(err).WithField("path", path).Warning("failed creating folder, skipping file")
+				continue
+			}
+			if err := ioutil.WriteFile(fullPath, contents, 0644); err != nil {
+				logrus.WithError(err).WithField("path", path).Warning("failed writing file, skipping it")
+				continue
+			}
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		message := c.String("message")
+		if message == "" {
+			message = "Export consul keys under " + listPrefix
+		}
+		commit, err := gitCollection.Commit(paths, message, &git2go.Signature{
+			Name:  c.String("author-name"),
+			Email: c.String("author-email"),
+			When:  time.Now(),
+		})
+		if err == git.ErrNoChanges {
+			logrus.WithField("prefix", listPrefix).Info("repository already matches consul, nothing to commit")
+			return nil
+		}
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		logrus.WithFields(logrus.Fields{"commit": commit, "files": len(paths)}).Info("committed exported keys")
+		if c.Bool("push") {
+			if err := gitCollection.Push(repo.cloneOptions(), repo.Remote, c.String("git-branch"), false); err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			logrus.WithFields(logrus.Fields{"remote": repo.Remote, "branch": c.String("git-branch")}).Info("pushed exported keys")
+		}
+		return nil
+	},
+}
+
+//exportFiles maps the keys under a prefix to repository paths and their contents. With a compact format
+//the segments past depth are compacted into one file per folder, folders that can not be compacted
+//are exported as a file per key
+func exportFiles(kvPairs api.KVPairs, prefix, format string, depth int) (map[string][]byte, error) {
+	listPrefix := prefix
+	if listPrefix != "" {
+		listPrefix += "/"
+	}
+	files := map[string][]byte{}
+	for _, kvPair := range kvPairs {
+		if !managedKey(prefix, kvPair.Key) {
+			continue
+		}
+		path := strings.TrimPrefix(kvPair.Key, listPrefix)
+		if !exportablePath(path) {
+			logrus.WithField("key", kvPair.Key).Warning("key does not map to a repository path, skipping it")
+			continue
+		}
+		files[path] = kvPair.Value
+	}
+	if format == "" {
+		return files, nil
+	}
+	ext := "." + format
+	encode, ok := expand.EncoderFor(ext)
+	if !ok {
+		return nil, errors.Errorf("unknown compact format %q", format)
+	}
+	folders := map[string]map[string][]byte{}
+	for path, value := range files {
+		segments := strings.Split(path, "/")
+		if len(segments) <= depth {
+			continue
+		}
+		folder := strings.Join(segments[:depth], "/")
+		if folders[folder] == nil {
+			folders[folder] = map[string][]byte{}
+		}
+		folders[folder][strings.Join(segments[depth:], "/")] = value
+		delete(files, path)
+	}
+	for folder, keys := range folders {
+		data, err := encode(keys)
+		if _, exists := files[folder+ext]; err == nil && exists {
+			err = errors.Errorf("a key already exports to %s", folder+ext)
+		}
+		if err != nil {
+			logrus.WithError(err).WithField("folder", folder).Warning("failed compacting folder, exporting a file per key")
+			for key, value := range keys {
+				files[folder+"/"+key] = value
+			}
+			continue
+		}
+		files[folder+ext] = data
+	}
+	return files, nil
+}
+
+//exportablePath tells whether a relative key can be written inside the repository
+func exportablePath(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		switch segment {
+		case "", ".", "..", ".git":
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,51 @@
+package command
+
+import (
+	"strings"
+
+	"git2consul/git"
+	"git2consul/ignore"
+)
+
+//ignoreFile lists paths of the repository that are not synced in gitignore syntax
+const ignoreFile = ".git2consulignore"
+
+//pathFilter decides which files of a repository are synced
+type pathFilter struct {
+	ignored  *ignore.Matcher
+	includes *ignore.Matcher
+	excludes *ignore.Matcher
+}
+
+//loadFilter reads the ignore file of a revision and combines it with the include and exclude globs of the repository
+func (r *repoConfig) loadFilter(gitCollection *git.Collection, revision string) (*pathFilter, error) {
+	data, err := gitCollection.ReadFileAt(revision, ignoreFile)
+	if err != nil {
+		return nil, err
+	}
+	return &pathFilter{
+		ignored:  ignore.Parse(data),
+		includes: ignore.New(r.Include...),
+		excludes: ignore.New(r.Exclude...),
+	}, nil
+}
+
+//allows tells whether a file is synced. .git and the ignore file are never synced, a nil filter allows every other file
+func (f *pathFilter) allows(path string) bool {
+	path = strings.Trim(path, "/")
+	if path == ignoreFile {
+		return false
+	}
+	for _, segment := range strings.Split(path, "/") {
+		if segment == ".git" {
+			return false
+		}
+	}
+	if f == nil {
+		return true
+	}
+	if !f.includes.Empty() && !f.includes.Match(path, false) {
+		return false
+	}
+	return !f.excludes.Match(path, false) && !f.ignored.Match(path, false)
+}
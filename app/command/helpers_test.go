@@ -0,0 +1,134 @@
+package command
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/pem"
+	"flag"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"git2consul/git"
+
+	git2go "github.com/libgit2/git2go/v29"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/crypto/ssh"
+)
+
+//testRepo is a repository in a temporary directory
+type testRepo struct {
+	t   *testing.T
+	dir string
+	*git2go.Repository
+}
+
+//newTestRepo initializes a repository, cleanup removes it again
+func newTestRepo(t *testing.T, bare bool) (*testRepo, func()) {
+	dir, err := ioutil.TempDir("", "git2consul-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := git2go.InitRepository(dir, bare)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return &testRepo{t: t, dir: dir, Repository: repo}, func() {
+		repo.Free()
+		os.RemoveAll(dir)
+	}
+}
+
+//collection returns the repository the way commands use it
+func (r *testRepo) collection() *git.Collection {
+	return &git.Collection{Repository: r.Repository}
+}
+
+//commit writes a commit of top level files on top of parents without moving any ref. It is signed
+//the way ssh-keygen -Y sign -n git signs when key is set
+func (r *testRepo) commit(files map[string]string, key ed25519.PrivateKey, message string, parents ...string) string {
+	builder, err := r.TreeBuilder()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	defer builder.Free()
+	for name, contents := range files {
+		blob, err := r.CreateBlobFromBuffer([]byte(contents))
+		if err != nil {
+			r.t.Fatal(err)
+		}
+		if err := builder.Insert(name, blob, git2go.FilemodeBlob); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+	tree, err := builder.Write()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	header := "tree " + tree.String() + "\n"
+	for _, parent := range parents {
+		header += "parent " + parent + "\n"
+	}
+	header += "author test <test@example.com> 1700000000 +0000\ncommitter test <test@example.com> 1700000000 +0000\n"
+	body := "\n" + message + "\n"
+	data := header + body
+	if key != nil {
+		sig := strings.TrimSuffix(sshSign(r.t, key, []byte(data)), "\n")
+		data = header + "gpgsig " + strings.Replace(sig, "\n", "\n ", -1) + "\n" + body
+	}
+	odb, err := r.Odb()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	defer odb.Free()
+	id, err := odb.Write([]byte(data), git2go.ObjectCommit)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return id.String()
+}
+
+//sshSign signs data the way ssh-keygen -Y sign -n git does
+func sshSign(t *testing.T, key ed25519.PrivateKey, data []byte) string {
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha512.Sum512(data)
+	signed := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Namespace, Reserved, Hash string
+		Digest                    []byte
+	}{"git", "", "sha512", digest[:]})...)
+	sig, err := signer.Sign(rand.Reader, signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := append([]byte("SSHSIG"), ssh.Marshal(struct {
+		Version                   uint32
+		PublicKey                 []byte
+		Namespace, Reserved, Hash string
+		Signature                 []byte
+	}{1, signer.PublicKey().Marshal(), "git", "", "sha512", ssh.Marshal(sig)})...)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "SSH SIGNATURE", Bytes: blob}))
+}
+
+//testContext returns the context of a command run with string flags
+func testContext(flags map[string]string) *cli.Context {
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	for name, value := range flags {
+		set.String(name, value, "")
+	}
+	return cli.NewContext(cli.NewApp(), set, nil)
+}
+
+//testBranch returns the branch a repository syncs under prefix
+func testBranch(t *testing.T, repo *repoConfig, prefix string) *branch {
+	b, err := repo.newBranch("main", prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
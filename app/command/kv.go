@@ -0,0 +1,182 @@
+package command
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"git2consul/consul"
+	"git2consul/expand"
+	"git2consul/git"
+	"git2consul/normalize"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/sirupsen/logrus"
+)
+
+//consulKey joins the consul path and a repository path into a consul key
+func consulKey(consulPath, path string) string {
+	return strings.TrimLeft(filepath.Join(consulPath, path), "/")
+}
+
+//consulPrefix returns the prefix the keys under a consul path start with, it ends in a slash so
+//listing it leaves out sibling paths that share its name
+func consulPrefix(consulPath string) string {
+	prefix := consulKey(consulPath, "")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return prefix
+}
+
+//fileKeys returns the consul keys and values a file syncs to. When expand-keys is set text files with
+//a registered expander are written as a key per field under the file's key, other files are
+//written as a single value normalized with the policy of the file. Whether a file is binary is
+//decided from its blob so a sync, resync, plan and drift check agree on its value
+func fileKeys(b *branch, key, path string, contents []byte) map[string][]byte {
+	binary := normalize.IsBinary(contents)
+	if b.repo.ExpandKeys && !binary {
+		if fn, ok := expand.ForFile(path); ok {
+			expanded, err := fn(contents)
+			if err == nil {
+				keys := make(map[string][]byte, len(expanded))
+				for field, value := range expanded {
+					keys[key+"/"+field] = value
+				}
+				return keys
+			}
+			logrus.WithError(err).WithField("path", path).Warning("failed expanding file, syncing it as a single key")
+		}
+	}
+	return map[string][]byte{key: b.normalization.apply(path, contents, binary)}
+}
+
+//stateKey returns the key the sync state is kept at for a consul path
+func stateKey(consulPath string) string {
+	return consulKey(consulPath, consul.StateKey)
+}
+
+//stepKey returns the key a replayed commit is recorded at for a consul path
+func stepKey(consulPath, commit string) string {
+	return consulKey(consulPath, consul.StepsKey+"/"+commit)
+}
+
+//newState returns the sync state for a commit of a branch
+func newState(b *branch, commit string) *consul.State {
+	return &consul.State{
+		Commit:        commit,
+		Repository:    b.repo.URL,
+		Branch:        b.name,
+		Timestamp:     time.Now().UTC(),
+		Normalization: b.normalization.state(),
+	}
+}
+
+//deltaOps returns the operations that apply diff deltas to consul, one group per delta that has to be
+//applied atomically. read returns the new contents of a delta
+func deltaOps(b *branch, gitCollection *git.Collection, diffs []*git.DiffDelta, read func(*git.DiffDelta) []byte) []api.KVTxnOps {
+	var groups []api.KVTxnOps
+	for _, diff := range diffs {
+		var removeOld, writeNew bool
+		switch diff.Status {
+		case "Added":
+			writeNew = true
+		case "Deleted":
+			removeOld = true
+		case "Modified", "Renamed":
+			// a rename deletes the keys of the old path in the same transaction that writes the new path
+			removeOld, writeNew = true, true
+		case "Copied":
+			// the source of a copy is left as it is
+			writeNew = true
+		case "TypeChange":
+			removeOld, writeNew = true, true
+		default:
+			logrus.WithFields(logrus.Fields{
+				"delta-status": diff.Status,
+				"new-file":     diff.NewFile,
+			}).Debug("skipping delta")
+			continue
+		}
+		oldKey, oldMapped := b.key(diff.OldFile)
+		newKey, newMapped := b.key(diff.NewFile)
+		// only regular files have keys, symlinks and submodules are never read or written
+		removeOld = removeOld && diff.OldIsFile() && oldMapped && b.filter.allows(diff.OldFile)
+		writeNew = writeNew && diff.NewIsFile() && newMapped && b.filter.allows(diff.NewFile)
+		oldKeys := map[string][]byte{}
+		if removeOld {
+			oldKeys = fileKeys(b, oldKey, diff.OldFile, gitCollection.ReadBlob(diff.OldID))
+		}
+		newKeys := map[string][]byte{}
+		if writeNew {
+			newKeys = fileKeys(b, newKey, diff.NewFile, read(diff))
+		}
+		group := append(setOps(newKeys), deleteOps(oldKeys, newKeys)...)
+		if len(group) > 0 {
+			groups = append(groups, group)
+		}
+		logrus.WithFields(logrus.Fields{
+			"delta-status": diff.Status,
+			"old-file":     diff.OldFile,
+			"new-file":     diff.NewFile,
+		}).Info("processed delta")
+	}
+	return groups
+}
+
+//commitOps returns a group of set operations for every mapped file of a commit that is not in skip
+func commitOps(b *branch, gitCollection *git.Collection, commit string, skip map[string]bool) ([]api.KVTxnOps, error) {
+	files, err := gitCollection.Files(commit)
+	if err != nil {
+		logrus.WithError(err).WithField("commit", commit).Error("failed to list the files of the commit")
+		return nil, err
+	}
+	var groups []api.KVTxnOps
+	for _, file := range files {
+		key, mapped := b.key(file.Path)
+		if !mapped || !b.filter.allows(file.Path) || skip[file.Path] {
+			continue
+		}
+		groups = append(groups, setOps(fileKeys(b, key, file.Path, gitCollection.ReadBlob(file.ID))))
+	}
+	return groups, nil
+}
+
+//flattenOps joins groups of operations into one list
+func flattenOps(groups []api.KVTxnOps) api.KVTxnOps {
+	var ops api.KVTxnOps
+	for _, group := range groups {
+		ops = append(ops, group...)
+	}
+	return ops
+}
+
+//setOps returns a set operation for every key ordered by key
+func setOps(keys map[string][]byte) api.KVTxnOps {
+	ops := make(api.KVTxnOps, 0, len(keys))
+	for _, key := range sortedKeys(keys) {
+		ops = append(ops, &api.KVTxnOp{Verb: api.KVSet, Key: key, Value: keys[key], Flags: consul.WriteFlag})
+	}
+	return ops
+}
+
+//deleteOps returns a delete operation for every key of oldKeys missing from newKeys
+func deleteOps(oldKeys, newKeys map[string][]byte) api.KVTxnOps {
+	var ops api.KVTxnOps
+	for _, key := range sortedKeys(oldKeys) {
+		if _, ok := newKeys[key]; !ok {
+			ops = append(ops, &api.KVTxnOp{Verb: api.KVDelete, Key: key})
+		}
+	}
+	return ops
+}
+
+func sortedKeys(keys map[string][]byte) []string {
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,102 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//mapping syncs the files under a source root of the repository to keys under a mountpoint
+type mapping struct {
+	sourceRoot string
+	mountpoint string
+}
+
+//parseMapping reads a mapping written as source_root=mountpoint
+func parseMapping(s string) (mapping, error) {
+	i := strings.Index(s, "=")
+	if i < 0 {
+		return mapping{}, errors.Errorf("mapping %q needs to be written as source_root=mountpoint", s)
+	}
+	return mapping{sourceRoot: strings.Trim(s[:i], "/"), mountpoint: strings.Trim(s[i+1:], "/")}, nil
+}
+
+//mappings returns the source_root and mountpoint setting followed by the mappings of the repository
+func (r *repoConfig) mappings() ([]mapping, error) {
+	var mappings []mapping
+	if r.SourceRoot != "" || r.Mountpoint != "" {
+		mappings = append(mappings, mapping{sourceRoot: strings.Trim(r.SourceRoot, "/"), mountpoint: strings.Trim(r.Mountpoint, "/")})
+	}
+	for _, s := range r.Mappings {
+		m, err := parseMapping(s)
+		if err != nil {
+			return nil, err
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, nil
+}
+
+//contains tells whether a repository path is under the source root
+func (m mapping) contains(path string) bool {
+	return m.sourceRoot == "" || path == m.sourceRoot || strings.HasPrefix(path, m.sourceRoot+"/")
+}
+
+//key returns the consul key a file of the branch syncs to. Without mappings files sync under the consul path
+//of the branch, with mappings the longest source root containing the file decides and files outside every
+//source root are not synced
+func (b *branch) key(path string) (string, bool) {
+	path = strings.Trim(path, "/")
+	if len(b.mappings) == 0 {
+		return consulKey(b.prefix, b.transform.apply(path)), true
+	}
+	var best *mapping
+	for i, m := range b.mappings {
+		if m.contains(path) && (best == nil || len(m.sourceRoot) > len(best.sourceRoot)) {
+			best = &b.mappings[i]
+		}
+	}
+	if best == nil {
+		return "", false
+	}
+	rel := strings.TrimPrefix(strings.TrimPrefix(path, best.sourceRoot), "/")
+	return consulKey(consulKey(b.prefix, best.mountpoint), b.transform.apply(rel)), true
+}
+
+//path returns the file of the branch that syncs to a key, it is the reverse of key. Keys renamed
+//by a key transformation have no file
+func (b *branch) path(key string) (string, bool) {
+	if len(b.mappings) == 0 {
+		root := consulKey(b.prefix, "")
+		path := key
+		if root != "" {
+			if !strings.HasPrefix(key, root+"/") {
+				return "", false
+			}
+			path = strings.TrimPrefix(key, root+"/")
+		}
+		if mapped, _ := b.key(path); mapped != key {
+			return "", false
+		}
+		return path, true
+	}
+	for _, m := range b.mappings {
+		mount := consulKey(b.prefix, m.mountpoint)
+		var path string
+		switch {
+		case mount == "":
+			path = consulKey(m.sourceRoot, key)
+		case key == mount:
+			// a file at the source root itself syncs to the mountpoint
+			path = m.sourceRoot
+		case strings.HasPrefix(key, mount+"/"):
+			path = consulKey(m.sourceRoot, strings.TrimPrefix(key, mount+"/"))
+		default:
+			continue
+		}
+		if mapped, ok := b.key(path); ok && mapped == key {
+			return path, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,49 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBranchKey(t *testing.T) {
+	mapped := testBranch(t, &repoConfig{
+		SourceRoot: "config/",
+		Mountpoint: "/svc",
+		Mappings:   []string{"config/prod/=prod/", "shared=/"},
+	}, "app")
+	unmapped := testBranch(t, &repoConfig{}, "app")
+	tests := []struct {
+		name   string
+		branch *branch
+		path   string
+		key    string
+		mapped bool
+	}{
+		{name: "without mappings", branch: unmapped, path: "a/b.yml", key: "app/a/b.yml", mapped: true},
+		{name: "under a source root", branch: mapped, path: "config/db.yml", key: "app/svc/db.yml", mapped: true},
+		{name: "longest overlapping source root wins", branch: mapped, path: "config/prod/db.yml", key: "app/prod/db.yml", mapped: true},
+		{name: "path equal to the source root", branch: mapped, path: "config/prod", key: "app/prod", mapped: true},
+		{name: "mountpoint at the consul path", branch: mapped, path: "shared/x", key: "app/x", mapped: true},
+		{name: "trailing slashes", branch: mapped, path: "/config/db.yml/", key: "app/svc/db.yml", mapped: true},
+		{name: "outside every mapping", branch: mapped, path: "other/db.yml", mapped: false},
+		{name: "sibling sharing a name prefix", branch: mapped, path: "configs/db.yml", mapped: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, ok := test.branch.key(test.path)
+			if ok != test.mapped || key != test.key {
+				t.Fatalf("expected %s to map to %q (%v), got %q (%v)", test.path, test.key, test.mapped, key, ok)
+			}
+			if !test.mapped {
+				return
+			}
+			path, ok := test.branch.path(key)
+			if expected := strings.Trim(test.path, "/"); !ok || path != expected {
+				t.Errorf("expected %s to map back to %s, got %q (%v)", key, expected, path, ok)
+			}
+		})
+	}
+	if path, ok := mapped.path("other/db.yml"); ok {
+		t.Errorf("expected a key outside the consul path to have no file, got %s", path)
+	}
+}
@@ -59,19 +59,67 @@ var (
 		},
 	})
 
+	consulGitDrift = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "git2consul",
+		Name:      "drift_keys",
+		Help:      "The number of consul keys that drifted from git by kind",
+		ConstLabels: prometheus.Labels{
+			"source":   "git",
+			"sink":     "consul",
+			"instance": os.Getenv("HOSTNAME"),
+		},
+	}, []string{"kind", "consul_path"})
+
+	consulGitConflicts = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "git2consul",
+		Name:      "conflict_keys",
+		Help:      "The number of keys edited in consul that git changes were not applied to",
+		ConstLabels: prometheus.Labels{
+			"source":   "git",
+			"sink":     "consul",
+			"instance": os.Getenv("HOSTNAME"),
+		},
+	}, []string{"consul_path"})
+
+	consulGitHistoryRewritten = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "git2consul",
+		Name:      "history_rewritten_total",
+		Help:      "The total number of times the head of a branch no longer descended from the applied commit",
+		ConstLabels: prometheus.Labels{
+			"source":   "git",
+			"sink":     "consul",
+			"instance": os.Getenv("HOSTNAME"),
+		},
+	}, []string{"consul_path"})
+
+	consulGitUnverifiedCommits = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "git2consul",
+		Name:      "unverified_commits_total",
+		Help:      "The total number of times a commit without a trusted signature was refused",
+		ConstLabels: prometheus.Labels{
+			"source":   "git",
+			"sink":     "consul",
+			"instance": os.Getenv("HOSTNAME"),
+		},
+	}, []string{"consul_path"})
+
 	registry = prometheus.NewRegistry()
 )
 
-func metricsInit(port string) {
-	registry.MustRegister(consulGitSynced, consulGitSyncedFailed, consulGitConnectionFailed, consulGitReads)
+func metricsInit() {
+	registry.MustRegister(consulGitSynced, consulGitSyncedFailed, consulGitConnectionFailed, consulGitReads, consulGitDrift, consulGitConflicts, consulGitHistoryRewritten, consulGitUnverifiedCommits)
+	http.Handle("/metrics", promhttp.Handler())
+	logrus.WithField("path", "/metrics").Info("serving metrics")
+}
+
+//serve starts the http server shared by metrics and webhooks
+func serve(port string) {
 	go func() {
-		http.Handle("/metrics", promhttp.Handler())
-		http.ListenAndServe(":"+port, nil)
+		if err := http.ListenAndServe(":"+port, nil); err != nil {
+			logrus.WithError(err).WithField("port", port).Error("http server stopped")
+		}
 	}()
-	logrus.WithFields(logrus.Fields{
-		"path": "/metrics",
-		"port": port,
-	}).Info("started metrics server on port")
+	logrus.WithField("port", port).Info("started http server on port")
 }
 
 func pushMetrics(address string) {
@@ -0,0 +1,104 @@
+package command
+
+import (
+	"strings"
+
+	"git2consul/consul"
+	"git2consul/ignore"
+	"git2consul/normalize"
+
+	"github.com/pkg/errors"
+)
+
+//normalization decides the policy the contents of each file are normalized with
+type normalization struct {
+	fallback string
+	rules    []normalizeRule
+}
+
+//normalizeRule applies a policy to the files matching a glob
+type normalizeRule struct {
+	glob    string
+	matcher *ignore.Matcher
+	policy  string
+}
+
+//legacyNormalization is how values were written before the policy was recorded in the sync state
+var legacyNormalization = &normalization{fallback: normalize.Trim}
+
+//newNormalization returns the normalization of a default policy and glob=policy rules
+func newNormalization(fallback string, rules []string) (*normalization, error) {
+	if fallback == "" {
+		fallback = normalize.Trim
+	}
+	if !normalize.Valid(fallback) {
+		return nil, errors.Errorf("unknown normalize policy %q", fallback)
+	}
+	n := &normalization{fallback: fallback}
+	for _, s := range rules {
+		i := strings.LastIndex(s, "=")
+		if i < 0 {
+			return nil, errors.Errorf("normalize rule %q needs to be written as glob=policy", s)
+		}
+		glob, policy := s[:i], s[i+1:]
+		if !normalize.Valid(policy) {
+			return nil, errors.Errorf("unknown normalize policy %q in rule %q", policy, s)
+		}
+		n.rules = append(n.rules, normalizeRule{glob: glob, matcher: ignore.New(glob), policy: policy})
+	}
+	return n, nil
+}
+
+//normalization returns the normalization configured for the repository
+func (r *repoConfig) normalization() (*normalization, error) {
+	return newNormalization(r.Normalize, r.NormalizeRules)
+}
+
+//recordedNormalization returns the normalization the values of a sync state were written with. States
+//written before the policy was recorded trimmed every value
+func recordedNormalization(state *consul.State) (*normalization, error) {
+	if state.Normalization == nil {
+		return legacyNormalization, nil
+	}
+	return newNormalization(state.Normalization.Default, state.Normalization.Rules)
+}
+
+//policy returns the policy of a file, the last matching rule wins
+func (n *normalization) policy(path string) string {
+	if n == nil {
+		return normalize.Trim
+	}
+	policy := n.fallback
+	for _, rule := range n.rules {
+		if rule.matcher.Match(path, false) {
+			policy = rule.policy
+		}
+	}
+	return policy
+}
+
+//apply normalizes the contents of a file
+func (n *normalization) apply(path string, contents []byte, binary bool) []byte {
+	return normalize.Apply(n.policy(path), contents, binary)
+}
+
+//state returns the normalization as it is recorded in the sync state
+func (n *normalization) state() *consul.Normalization {
+	if n == nil {
+		return nil
+	}
+	recorded := &consul.Normalization{Default: n.fallback}
+	for _, rule := range n.rules {
+		recorded.Rules = append(recorded.Rules, rule.glob+"="+rule.policy)
+	}
+	return recorded
+}
+
+//equal tells whether two normalizations write the same values
+func (n *normalization) equal(other *normalization) bool {
+	a, b := n.state(), other.state()
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Default == b.Default && strings.Join(a.Rules, "\n") == strings.Join(b.Rules, "\n")
+}
@@ -0,0 +1,230 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"git2consul/consul"
+	"git2consul/git"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+var planCommand = cli.Command{
+	Name:        "plan",
+	Usage:       "show what a sync would change in consul without writing",
+	ArgsUsage:   "[flags]",
+	Description: "diff two revisions and compare the keys they write with consul. Exits with 0 when there are no changes, 2 when there are changes and 1 on errors",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "from", Usage: "revision to diff from, defaults to the last applied commit recorded in consul"},
+		&cli.StringFlag{Name: "to", Value: "HEAD", Usage: "revision to diff to, HEAD and HEAD~N are read from git-branch rather than the checked out branch"},
+		&cli.StringFlag{Name: "format", Value: "text", Usage: "output format [text, json]"},
+	},
+	Action: func(c *cli.Context) error {
+		setLog(c)
+		// keep stdout for the plan itself
+		logrus.SetOutput(os.Stderr)
+		b, err := repoFromFlags(c).branch(c.String("git-branch"))
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		repo := b.repo.open()
+		if repo == nil {
+			return cli.Exit("could not intialize the repo", 1)
+		}
+		consulInteractor, err := consul.NewHandler(consul.Config(c.String("consul-addr"), c.String("consul-token")))
+		if err != nil {
+			consulGitConnectionFailed.Inc()
+			return cli.Exit(err.Error(), 1)
+		}
+		from, to := c.String("from"), b.revision(repo, c.String("to"))
+		if from != "" {
+			from = b.revision(repo, from)
+		} else {
+			state, err := consulInteractor.ReadState(stateKey(b.prefix))
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			if state != nil {
+				from = state.Commit
+			}
+		}
+		diffs, err := repo.Diff(from, to)
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		if b.filter, err = b.repo.loadFilter(repo, to); err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		if err := b.checkKeys(repo, to); err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		ops := flattenOps(deltaOps(b, repo, diffs, func(diff *git.DiffDelta) []byte {
+			return repo.ReadBlob(diff.NewID)
+		}))
+		kvPairs, err := consulInteractor.List(consulPrefix(b.prefix))
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		plan := &plan{From: from, To: to, Changes: planChanges(ops, kvPairs)}
+		switch c.String("format") {
+		case "json":
+			encoder := json.NewEncoder(c.App.Writer)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(plan)
+		case "text":
+			err = plan.write(c.App.Writer)
+		default:
+			return cli.Exit(fmt.Sprintf("unknown format %q", c.String("format")), 1)
+		}
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		if len(plan.Changes) > 0 {
+			return cli.Exit("", 2)
+		}
+		return nil
+	},
+}
+
+//plan lists the changes a sync would make to consul
+type plan struct {
+	From    string    `json:"from"`
+	To      string    `json:"to"`
+	Changes []*change `json:"changes"`
+}
+
+//change of a single consul key
+type change struct {
+	Action string `json:"action"`
+	Key    string `json:"key"`
+	Old    string `json:"old,omitempty"`
+	New    string `json:"new,omitempty"`
+}
+
+const (
+	actionAdd    = "add"
+	actionChange = "change"
+	actionDelete = "delete"
+)
+
+//planChanges applies ops to a copy of the consul values and returns the keys that end up different
+func planChanges(ops api.KVTxnOps, kvPairs api.KVPairs) []*change {
+	current := make(map[string][]byte, len(kvPairs))
+	for _, kvPair := range kvPairs {
+		current[kvPair.Key] = kvPair.Value
+	}
+	planned := map[string][]byte{}
+	deleted := map[string]bool{}
+	for _, op := range ops {
+		switch op.Verb {
+		case api.KVSet:
+			planned[op.Key] = op.Value
+			delete(deleted, op.Key)
+		case api.KVDelete:
+			delete(planned, op.Key)
+			deleted[op.Key] = true
+		}
+	}
+	var changes []*change
+	for key, value := range planned {
+		old, ok := current[key]
+		switch {
+		case !ok:
+			changes = append(changes, &change{Action: actionAdd, Key: key, New: string(value)})
+		case string(old) != string(value):
+			changes = append(changes, &change{Action: actionChange, Key: key, Old: string(old), New: string(value)})
+		}
+	}
+	for key := range deleted {
+		if old, ok := current[key]; ok {
+			changes = append(changes, &change{Action: actionDelete, Key: key, Old: string(old)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+func (p *plan) write(w io.Writer) error {
+	counts := map[string]int{}
+	symbols := map[string]string{actionAdd: "+", actionChange: "~", actionDelete: "-"}
+	for _, change := range p.Changes {
+		counts[change.Action]++
+		if _, err := fmt.Fprintf(w, "%s %s\n", symbols[change.Action], change.Key); err != nil {
+			return err
+		}
+		for _, line := range lineDiff(change.Old, change.New, change.Action != actionAdd, change.Action != actionDelete) {
+			if _, err := fmt.Fprintf(w, "    %s\n", line); err != nil {
+				return err
+			}
+		}
+	}
+	if len(p.Changes) == 0 {
+		_, err := fmt.Fprintf(w, "No changes. Consul matches %s.\n", p.To)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\nPlan: %d to add, %d to change, %d to delete.\n", counts[actionAdd], counts[actionChange], counts[actionDelete])
+	return err
+}
+
+//maxDiffCells bounds the size of the table used to diff values line by line
+const maxDiffCells = 1 << 20
+
+//lineDiff returns the lines of old prefixed by - and the lines of new prefixed by + around their common lines
+func lineDiff(old, new string, hasOld, hasNew bool) []string {
+	var a, b []string
+	if hasOld {
+		a = strings.Split(old, "\n")
+	}
+	if hasNew {
+		b = strings.Split(new, "\n")
+	}
+	if len(a)*len(b) > maxDiffCells {
+		var lines []string
+		for _, line := range a {
+			lines = append(lines, "- "+line)
+		}
+		for _, line := range b {
+			lines = append(lines, "+ "+line)
+		}
+		return lines
+	}
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+	return lines
+}
@@ -0,0 +1,54 @@
+package command
+
+import (
+	"time"
+
+	"git2consul/consul"
+	"git2consul/git"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+//replay applies the commits of a branch since from one by one, oldest first, and returns the last commit
+//applied. Every commit is its own transaction that records a step, a commit that fails is recorded with
+//its error and stops the replay until the next sync
+func replay(c *cli.Context, b *branch, gitCollection *git.Collection, consulInteractor *consul.ConsulHandler, from string, a *applied, pairs map[string]*api.KVPair, guards api.KVTxnOps) (string, error) {
+	commits, err := gitCollection.CommitsSince(b.name, from)
+	if err != nil {
+		return from, err
+	}
+	current := from
+	for i, commit := range commits {
+		if a != nil && i > 0 {
+			// keys edited in consul are compared with the commit the previous step applied
+			if a, err = readApplied(b, gitCollection, current, nil); err != nil {
+				return current, err
+			}
+			if pairs, err = listManaged(b, consulInteractor); err != nil {
+				return current, err
+			}
+		}
+		step := &consul.Step{
+			Commit:  commit.ID,
+			Parent:  current,
+			Author:  commit.Author,
+			Message: commit.Message,
+			Applied: time.Now().UTC(),
+		}
+		log := logrus.WithFields(logrus.Fields{"branch": b.name, "commit": commit.ID, "author": commit.Author, "step": i + 1, "steps": len(commits)})
+		if err := applyCommit(c, b, gitCollection, consulInteractor, current, commit.ID, a, pairs, step, guards); err != nil {
+			step.Operations, step.Conflicts, step.Error = 0, nil, err.Error()
+			if stepOp, opErr := consul.StepOp(stepKey(b.prefix, commit.ID), step); opErr == nil {
+				if txnErr := consulInteractor.ApplyTxn(api.KVTxnOps{stepOp}, consul.TxnReject, guards...); txnErr != nil {
+					log.WithError(txnErr).Error("failed recording the failed step")
+				}
+			}
+			return current, err
+		}
+		log.WithField("operations", step.Operations).Info("replayed commit")
+		current = commit.ID
+	}
+	return current, nil
+}
@@ -0,0 +1,410 @@
+package command
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"git2consul/git"
+	"git2consul/webhook"
+
+	"github.com/BurntSushi/toml"
+	git2go "github.com/libgit2/git2go/v29"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+//repoConfig describes a repository and where in consul it syncs to
+type repoConfig struct {
+	Name           string   `toml:"-"`
+	URL            string   `toml:"url"`
+	Branches       []string `toml:"branches"`
+	BranchPrefix   string   `toml:"branch-prefix"`
+	Tags           string   `toml:"tags"`
+	Prerelease     bool     `toml:"prerelease"`
+	Remote         string   `toml:"remote"`
+	User           string   `toml:"user"`
+	PasswordEnv    string   `toml:"password-env"`
+	PublicKeyPath  string   `toml:"ssh-publickey-path"`
+	PrivateKeyPath string   `toml:"ssh-privatekey-path"`
+	PassphrasePath string   `toml:"ssh-passphrase-path"`
+	Dir            string   `toml:"dir"`
+	Bare           bool     `toml:"bare"`
+	ConsulPath     string   `toml:"consul-path"`
+	Since          int64    `toml:"since"`
+	ExpandKeys     bool     `toml:"expand-keys"`
+	Include        []string `toml:"include"`
+	Exclude        []string `toml:"exclude"`
+	SourceRoot     string   `toml:"source_root"`
+	Mountpoint     string   `toml:"mountpoint"`
+	Mappings       []string `toml:"mappings"`
+	// key transformations
+	KeyStripExtensions []string `toml:"key-strip-extensions"`
+	KeyRewrites        []string `toml:"key-rewrites"`
+	KeySplitDots       bool     `toml:"key-split-dots"`
+	KeyCase            string   `toml:"key-case"`
+	// normalization of values
+	Normalize      string   `toml:"normalize"`
+	NormalizeRules []string `toml:"normalize-rules"`
+	password       string
+	fingerprint    []byte
+}
+
+//repoFromFlags returns the repository configured through the global flags
+func repoFromFlags(c *cli.Context) *repoConfig {
+	return &repoConfig{
+		URL:                c.String("git-url"),
+		Branches:           branchesFromFlags(c),
+		BranchPrefix:       c.String("branch-prefix"),
+		Tags:               c.String("tags"),
+		Prerelease:         c.Bool("prerelease"),
+		Remote:             c.String("git-remote"),
+		User:               c.String("git-user"),
+		PublicKeyPath:      c.String("git-ssh-publickey-path"),
+		PrivateKeyPath:     c.String("git-ssh-privatekey-path"),
+		PassphrasePath:     c.String("git-ssh-passphrase-path"),
+		Dir:                c.String("git-dir"),
+		Bare:               c.Bool("git-bare"),
+		ConsulPath:         c.String("consul-path"),
+		Since:              c.Int64("since"),
+		ExpandKeys:         c.Bool("expand-keys"),
+		Include:            c.StringSlice("include"),
+		Exclude:            c.StringSlice("exclude"),
+		SourceRoot:         c.String("source-root"),
+		Mountpoint:         c.String("mountpoint"),
+		Mappings:           c.StringSlice("mapping"),
+		KeyStripExtensions: c.StringSlice("key-strip-extension"),
+		KeyRewrites:        c.StringSlice("key-rewrite"),
+		KeySplitDots:       c.Bool("key-split-dots"),
+		KeyCase:            c.String("key-case"),
+		Normalize:          c.String("normalize"),
+		NormalizeRules:     c.StringSlice("normalize-rule"),
+		password:           c.String("git-password"),
+		fingerprint:        []byte(c.String("git-fingerprint-path")),
+	}
+}
+
+//branchesFromFlags returns the git-branches list, or git-branch when no list is set
+func branchesFromFlags(c *cli.Context) []string {
+	if branches := c.StringSlice("git-branches"); len(branches) > 0 {
+		return branches
+	}
+	return []string{c.String("git-branch")}
+}
+
+//loadRepos reads the [repos.<name>] tables of the config file. Settings a repository
+//leaves out are taken from the global flags, booleans it sets to false stay false
+func loadRepos(c *cli.Context) ([]*repoConfig, error) {
+	if c.String("config-file") == "" {
+		return nil, nil
+	}
+	file := struct {
+		Repos map[string]*repoConfig `toml:"repos"`
+	}{}
+	meta, err := toml.DecodeFile(c.String("config-file"), &file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading repositories from config file")
+	}
+	defaults := repoFromFlags(c)
+	var repos []*repoConfig
+	for name, repo := range file.Repos {
+		if repo.URL == "" {
+			return nil, errors.Errorf("repository %s needs a url", name)
+		}
+		repo.Name = name
+		if len(repo.Branches) == 0 {
+			repo.Branches = defaults.Branches
+		}
+		if repo.BranchPrefix == "" {
+			repo.BranchPrefix = defaults.BranchPrefix
+		}
+		if repo.Tags == "" {
+			repo.Tags = defaults.Tags
+		}
+		if !meta.IsDefined("repos", name, "prerelease") {
+			repo.Prerelease = defaults.Prerelease
+		}
+		if repo.Remote == "" {
+			repo.Remote = defaults.Remote
+		}
+		if repo.User == "" {
+			repo.User = defaults.User
+		}
+		if repo.PublicKeyPath == "" && repo.PrivateKeyPath == "" {
+			repo.PublicKeyPath, repo.PrivateKeyPath, repo.PassphrasePath = defaults.PublicKeyPath, defaults.PrivateKeyPath, defaults.PassphrasePath
+		}
+		if repo.Dir == "" {
+			repo.Dir = filepath.Join(defaults.Dir, name)
+		}
+		if repo.ConsulPath == "" {
+			repo.ConsulPath = name
+		}
+		if repo.Since == 0 {
+			repo.Since = defaults.Since
+		}
+		if !meta.IsDefined("repos", name, "expand-keys") {
+			repo.ExpandKeys = defaults.ExpandKeys
+		}
+		if !meta.IsDefined("repos", name, "bare") {
+			repo.Bare = defaults.Bare
+		}
+		if len(repo.Include) == 0 {
+			repo.Include = defaults.Include
+		}
+		if len(repo.Exclude) == 0 {
+			repo.Exclude = defaults.Exclude
+		}
+		if repo.SourceRoot == "" && repo.Mountpoint == "" && len(repo.Mappings) == 0 {
+			repo.SourceRoot, repo.Mountpoint, repo.Mappings = defaults.SourceRoot, defaults.Mountpoint, defaults.Mappings
+		}
+		if len(repo.KeyStripExtensions) == 0 {
+			repo.KeyStripExtensions = defaults.KeyStripExtensions
+		}
+		if len(repo.KeyRewrites) == 0 {
+			repo.KeyRewrites = defaults.KeyRewrites
+		}
+		if !meta.IsDefined("repos", name, "key-split-dots") {
+			repo.KeySplitDots = defaults.KeySplitDots
+		}
+		if repo.KeyCase == "" {
+			repo.KeyCase = defaults.KeyCase
+		}
+		if repo.Normalize == "" {
+			repo.Normalize = defaults.Normalize
+		}
+		if len(repo.NormalizeRules) == 0 {
+			repo.NormalizeRules = defaults.NormalizeRules
+		}
+		if repo.PasswordEnv != "" {
+			repo.password = os.Getenv(repo.PasswordEnv)
+		}
+		repo.fingerprint = defaults.fingerprint
+		repos = append(repos, repo)
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
+	return repos, nil
+}
+
+//branch is a branch of a repository and the consul path it syncs to
+type branch struct {
+	repo   *repoConfig
+	name   string
+	prefix string
+	// filter of the revision being synced
+	filter *pathFilter
+	// mappings of source roots to mountpoints under prefix
+	mappings []mapping
+	// transform of paths below their mountpoint
+	transform *keyTransform
+	// normalization of the values written
+	normalization *normalization
+}
+
+//ref returns the reference the branch is read from. Commands read it instead of HEAD, which is
+//whichever branch sync checked out last when a clone tracks several branches
+func (b *branch) ref(gitCollection *git.Collection) string {
+	if b.name == "" {
+		return "HEAD"
+	}
+	return gitCollection.BranchRef(b.repo.Remote, b.name)
+}
+
+//revision resolves an empty revision and revisions relative to HEAD such as HEAD~2 against the branch
+func (b *branch) revision(gitCollection *git.Collection, revision string) string {
+	if revision == "" {
+		return b.ref(gitCollection)
+	}
+	if revision == "HEAD" || strings.HasPrefix(revision, "HEAD~") || strings.HasPrefix(revision, "HEAD^") {
+		return b.ref(gitCollection) + strings.TrimPrefix(revision, "HEAD")
+	}
+	return revision
+}
+
+//prefixData is what a branch-prefix template is rendered with
+type prefixData struct {
+	Repo   string
+	Branch string
+}
+
+//branch returns a branch of the repository and the consul path it syncs to. The branch-prefix
+//template is rendered under the consul path, repositories tracking several branches default to
+//one path per branch
+func (r *repoConfig) branch(name string) (*branch, error) {
+	prefix := r.BranchPrefix
+	if prefix == "" && r.multiBranch() {
+		prefix = "{{.Branch}}"
+	}
+	if prefix == "" {
+		return r.newBranch(name, r.ConsulPath)
+	}
+	tmpl, err := template.New("branch-prefix").Option("missingkey=error").Parse(prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed parsing branch-prefix")
+	}
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, prefixData{Repo: r.repoName(), Branch: name}); err != nil {
+		return nil, errors.Wrapf(err, "failed rendering branch-prefix for branch %s", name)
+	}
+	return r.newBranch(name, consulKey(r.ConsulPath, rendered.String()))
+}
+
+//tagBranch returns what a repository in tag mode syncs, tags are written to the consul path
+func (r *repoConfig) tagBranch() (*branch, error) {
+	return r.newBranch("", r.ConsulPath)
+}
+
+//newBranch returns a branch syncing to prefix with the mappings and key transformation of the repository
+func (r *repoConfig) newBranch(name, prefix string) (*branch, error) {
+	mappings, err := r.mappings()
+	if err != nil {
+		return nil, err
+	}
+	transform, err := r.transform()
+	if err != nil {
+		return nil, err
+	}
+	normalization, err := r.normalization()
+	if err != nil {
+		return nil, err
+	}
+	return &branch{repo: r, name: name, prefix: prefix, mappings: mappings, transform: transform, normalization: normalization}, nil
+}
+
+//multiBranch tells whether more than one branch may be tracked
+func (r *repoConfig) multiBranch() bool {
+	return len(r.Branches) > 1 || (len(r.Branches) == 1 && isGlob(r.Branches[0]))
+}
+
+//repoName is the configured name of the repository or the last element of its url
+func (r *repoConfig) repoName() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	name := strings.TrimSuffix(strings.TrimSuffix(r.URL, "/"), ".git")
+	if i := strings.LastIndexAny(name, "/:"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+func isGlob(branch string) bool {
+	return strings.ContainsAny(branch, "*?[")
+}
+
+//tracks tells whether a branch is one of the tracked branches or matches one of their globs
+func (r *repoConfig) tracks(name string) bool {
+	for _, pattern := range r.Branches {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+//resolveBranches returns the tracked branches with globs expanded against the branches of the remote
+func (r *repoConfig) resolveBranches(gitCollection *git.Collection) ([]string, error) {
+	seen := map[string]bool{}
+	var names []string
+	for _, pattern := range r.Branches {
+		matches := []string{pattern}
+		if isGlob(pattern) {
+			var err error
+			if matches, err = gitCollection.RemoteBranches(r.cloneOptions(), r.Remote, pattern); err != nil {
+				return nil, err
+			}
+			if len(matches) == 0 {
+				logrus.WithField("pattern", pattern).Warning("no remote branch matches")
+			}
+		}
+		for _, name := range matches {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names, nil
+}
+
+//open clones or opens the local copy of the repository
+func (r *repoConfig) open() *git.Collection {
+	return git.NewRepository(git.Username(r.User),
+		git.Password(r.password),
+		git.URL(r.URL),
+		git.PullDir(r.Dir),
+		git.Bare(r.Bare),
+		git.PublicKeyPath(r.PublicKeyPath),
+		git.PrivateKeyPath(r.PrivateKeyPath),
+	)
+}
+
+//pull fetches and checks out a branch of the repository. A bare clone is a mirror that only fetches,
+//force pushes are reported and synced as the difference between the old and the new tree
+func (r *repoConfig) pull(gitCollection *git.Collection, branch string) *git.Collection {
+	if !gitCollection.IsBare() {
+		return gitCollection.Pull(r.cloneOptions(), r.Remote, branch)
+	}
+	result, err := gitCollection.Fetch(r.cloneOptions(), r.Remote, branch)
+	if err != nil {
+		logrus.WithError(err).WithField("branch", branch).Error("failed fetching branch")
+		return gitCollection
+	}
+	if result.Forced {
+		logrus.WithFields(logrus.Fields{"branch": branch, "old": result.Old, "new": result.New}).Warning("branch was force pushed, syncing the difference between the old and the new tree")
+	}
+	return gitCollection
+}
+
+//cloneOptions returns the credentials to fetch the repository with
+func (r *repoConfig) cloneOptions() *git2go.CloneOptions {
+	var passphrase string
+	if r.PassphrasePath != "" {
+		data, err := ioutil.ReadFile(r.PassphrasePath)
+		if err != nil {
+			logrus.WithError(err).WithField("path", r.PassphrasePath).Error("failed reading ssh passphrase")
+		}
+		passphrase = strings.TrimSpace(string(data))
+	}
+	return git.CloneOptions(r.User, r.password, r.PublicKeyPath, r.PrivateKeyPath, passphrase, r.fingerprint)
+}
+
+//pushed tells whether a push webhook updated one of the tracked branches or tags of the repository,
+//only is set when this is the only repository so any push refers to it
+func (r *repoConfig) pushed(push *webhook.Push, only bool) bool {
+	matched := only
+	for _, repository := range push.Repository {
+		matched = matched || r.matches(repository)
+	}
+	if !matched {
+		return false
+	}
+	for _, ref := range push.Refs {
+		if r.Tags != "" {
+			if strings.HasPrefix(ref, "refs/tags/") {
+				if ok, _ := path.Match(r.Tags, strings.TrimPrefix(ref, "refs/tags/")); ok {
+					return true
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(ref, "refs/heads/") && r.tracks(strings.TrimPrefix(ref, "refs/heads/")) {
+			return true
+		}
+	}
+	return false
+}
+
+//matches tells whether a repository name or clone url refers to this repository
+func (r *repoConfig) matches(repository string) bool {
+	trim := func(s string) string {
+		return strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(s), "/"), ".git")
+	}
+	url := trim(r.URL)
+	name := trim(repository)
+	return url == name || strings.HasSuffix(url, "/"+name) || strings.HasSuffix(url, ":"+name)
+}
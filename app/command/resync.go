@@ -1,9 +1,6 @@
 package command
 
 import (
-	"bytes"
-	"io/ioutil"
-	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
@@ -11,6 +8,8 @@ import (
 	"git2consul/consul"
 	"git2consul/git"
 
+	"github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 )
@@ -24,6 +23,9 @@ var resyncCommand = cli.Command{
 	Flags: []cli.Flag{
 		&cli.StringFlag{Name: "pre-shell", Value: "", Usage: "shell command to execute before syncing", Hidden: true},
 		&cli.StringFlag{Name: "post-shell", Value: "", Usage: "shell command to execute after syncing", Hidden: true},
+		&cli.BoolFlag{Name: "prune", Usage: "delete keys under the consul path that no file in the repository syncs to"},
+		&cli.BoolFlag{Name: "prune-dry-run", Usage: "list the keys prune would delete without writing to consul"},
+		&cli.IntFlag{Name: "prune-max-percent", Value: 25, Usage: "abort when prune would delete more than this percentage of the keys under the consul path"},
 	},
 	Before: func(c *cli.Context) error {
 		if c.String("pre-shell") != "" {
@@ -39,56 +41,142 @@ var resyncCommand = cli.Command{
 	},
 	Action: func(c *cli.Context) error {
 		setLog(c)
+		if err := validateSignatureFlags(c); err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
 		defer func() {
 			if c.Bool("metrics") {
 				pushMetrics(c.String("pushgateway-addr"))
 			}
 		}()
-		repo := git.NewRepository(git.Username(c.String("git-user")), git.Password(c.String("git-password")),
-			git.URL(c.String("git-url")),
-			git.PullDir(c.String("git-dir")),
-		)
+		b, err := repoFromFlags(c).branch(c.String("git-branch"))
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		repo := b.repo.open()
 		if repo == nil {
 			return cli.Exit("could not intialize the repo", 1)
 		}
 		consulGitReads.Inc()
-		err := filepath.Walk(c.String("git-dir"), func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				logrus.WithError(err).WithField("git-dir", c.String("git-dir")).Error("failed to walk the directory")
-				return err
-			}
-			if !info.IsDir() {
-				contents, err := ioutil.ReadFile(path)
-				if err != nil {
-					logrus.WithFields(
-						logrus.Fields{"path": path, "error": err},
-					).Error("failed reading file")
-				}
-				consulInteractor, err := consul.NewHandler(consul.Config(c.String("consul-addr"), c.String("consul-token")))
-				consulGitConnectionFailed.Inc()
-				if err != nil {
-					logrus.WithError(err).Error("failed connecting to consul")
-				}
-				path = strings.TrimPrefix(path, c.String("git-dir"))
-				consulPath := c.String("consul-path") + path
-				consulPath = strings.TrimLeft(consulPath, "/")
-				if ok, err := consulInteractor.Put(consulPath, bytes.TrimSpace(contents)); err != nil || !ok {
-					logrus.WithFields(logrus.Fields{
-						"path":        path,
-						"consul-path": consulPath,
-						"error":       err,
-					}).Error("failed adding contents")
-					consulGitSyncedFailed.Inc()
-					return nil
-				}
-				consulGitSynced.Inc()
-			}
-			return nil
-		})
+		consulInteractor, err := consul.NewHandler(consul.Config(c.String("consul-addr"), c.String("consul-token")))
 		if err != nil {
-			logrus.WithField("directory", c.String("git-dir")).Error("failed to read repository's path %s and sync to consul")
-			return cli.NewExitError(err.Error, 1)
+			logrus.WithError(err).Error("failed connecting to consul")
+			consulGitConnectionFailed.Inc()
+			return cli.Exit(err.Error(), 1)
+		}
+		if _, err := resync(c, b, repo, consulInteractor); err != nil {
+			return cli.Exit(err.Error(), 1)
 		}
 		return nil
 	},
 }
+
+//resync writes every file of the branch's commit to consul together with the sync state
+//and returns the commit that was applied. Guards are checked by every transaction
+func resync(c *cli.Context, b *branch, repo *git.Collection, consulInteractor *consul.ConsulHandler, guards ...*api.KVTxnOp) (string, error) {
+	commit, err := repo.ResolveCommit(b.ref(repo))
+	if err != nil {
+		logrus.WithError(err).WithField("branch", b.name).Error("failed to resolve the branch")
+		return "", err
+	}
+	return resyncCommit(c, b, repo, consulInteractor, commit, guards...)
+}
+
+//resyncCommit writes every file of a commit to consul together with the sync state
+func resyncCommit(c *cli.Context, b *branch, repo *git.Collection, consulInteractor *consul.ConsulHandler, commit string, guards ...*api.KVTxnOp) (string, error) {
+	var err error
+	if b.filter, err = b.repo.loadFilter(repo, commit); err != nil {
+		return "", err
+	}
+	if err := b.checkKeys(repo, commit); err != nil {
+		return "", err
+	}
+	// the commits since the applied one are checked, without a state the commit is checked alone
+	state, err := consulInteractor.ReadState(stateKey(b.prefix))
+	if err != nil {
+		return "", err
+	}
+	var from string
+	if state != nil && repo.HasCommit(state.Commit) {
+		from = state.Commit
+	}
+	if err := verifyCommits(c, b, repo, consulInteractor, from, commit); err != nil {
+		return "", err
+	}
+	groups, err := commitOps(b, repo, commit, nil)
+	if err != nil {
+		return "", err
+	}
+	ops := flattenOps(groups)
+	if c.Bool("prune") || c.Bool("prune-dry-run") {
+		pruned, err := pruneOps(consulInteractor, b.prefix, ops, c.Int("prune-max-percent"))
+		if err != nil {
+			return "", err
+		}
+		if c.Bool("prune-dry-run") {
+			for _, op := range pruned {
+				logrus.WithField("key", op.Key).Info("would prune key")
+			}
+			logrus.WithField("keys", len(pruned)).Info("prune dry run finished without writing to consul")
+			return "", nil
+		}
+		ops = append(ops, pruned...)
+	}
+	stateOp, err := consul.StateOp(stateKey(b.prefix), newState(b, commit))
+	if err != nil {
+		return "", err
+	}
+	ops = append(ops, stateOp)
+	if err := consulInteractor.ApplyTxn(ops, consul.TxnPolicy(c.String("txn-policy")), guards...); err != nil {
+		logrus.WithError(err).WithFields(logrus.Fields{
+			"consul-path": b.prefix,
+			"operations":  len(ops),
+		}).Error("failed adding contents")
+		consulGitSyncedFailed.Add(float64(len(ops)))
+		return "", err
+	}
+	consulGitSynced.Add(float64(len(ops)))
+	logrus.WithFields(logrus.Fields{"commit": commit, "branch": b.name}).Info("resynced repository")
+	return commit, nil
+}
+
+//pruneOps returns delete operations for keys under the consul path that are not written by ops.
+//Folder keys and git2consul metadata are left alone
+func pruneOps(consulInteractor *consul.ConsulHandler, consulPath string, ops api.KVTxnOps, maxPercent int) (api.KVTxnOps, error) {
+	prefix := consulKey(consulPath, "")
+	if prefix == "" {
+		return nil, errors.New("prune needs a consul-path to limit which keys are deleted")
+	}
+	prefix += "/"
+	keys, err := consulInteractor.Keys(prefix)
+	if err != nil {
+		return nil, err
+	}
+	synced := make(map[string]bool, len(ops))
+	for _, op := range ops {
+		synced[op.Key] = true
+	}
+	var pruned api.KVTxnOps
+	managed := 0
+	for _, key := range keys {
+		if !managedKey(consulPath, key) {
+			continue
+		}
+		managed++
+		if !synced[key] {
+			pruned = append(pruned, &api.KVTxnOp{Verb: api.KVDelete, Key: key})
+		}
+	}
+	if managed > 0 && len(pruned)*100 > maxPercent*managed {
+		return nil, errors.Errorf("aborting prune, %d of %d keys under %s would be deleted which is more than %d%%", len(pruned), managed, prefix, maxPercent)
+	}
+	logrus.WithFields(logrus.Fields{"keys": len(pruned), "consul-path": consulPath}).Info("found orphaned keys")
+	return pruned, nil
+}
+
+//managedKey tells whether a key under the consul path can be written by a file, folder keys and
+//git2consul metadata are not
+func managedKey(consulPath, key string) bool {
+	metadata := consulKey(consulPath, filepath.Dir(consul.StateKey)) + "/"
+	return !strings.HasSuffix(key, "/") && !strings.HasPrefix(key, metadata)
+}
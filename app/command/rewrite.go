@@ -0,0 +1,101 @@
+package command
+
+import (
+	"encoding/json"
+
+	"git2consul/consul"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+//historyRewrittenEvent is the consul user event fired when the head of a branch no longer descends from the applied commit
+const historyRewrittenEvent = "git2consul-history-rewritten"
+
+var approveRewriteCommand = cli.Command{
+	Name:        "approve-rewrite",
+	Usage:       "let sync apply a rewritten history it holds",
+	ArgsUsage:   "[--to <sha>]",
+	Description: "sync running with --rewrite-approval holds a branch whose head no longer descends from the applied commit and records the rewrite in the sync state. Approving it lets the next sync apply the difference between the applied tree and the new head",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "to", Usage: "head of the rewritten branch that is approved, refuses to approve when sync holds another head"},
+	},
+	Action: func(c *cli.Context) error {
+		setLog(c)
+		b, err := repoFromFlags(c).branch(c.String("git-branch"))
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		consulInteractor, err := consul.NewHandler(consul.Config(c.String("consul-addr"), c.String("consul-token")))
+		if err != nil {
+			consulGitConnectionFailed.Inc()
+			return cli.Exit(err.Error(), 1)
+		}
+		state, err := consulInteractor.ReadState(stateKey(b.prefix))
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		if state == nil || state.Rewrite == nil {
+			return cli.Exit("sync holds no rewritten history for this branch", 1)
+		}
+		if to := c.String("to"); to != "" && to != state.Rewrite.To {
+			return cli.Exit("sync holds "+state.Rewrite.To+", not "+to, 1)
+		}
+		state.Rewrite.Approved = true
+		stateOp, err := consul.StateOp(stateKey(b.prefix), state)
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		if err := consulInteractor.ApplyTxn(api.KVTxnOps{stateOp}, consul.TxnReject); err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		logrus.WithFields(logrus.Fields{"from": state.Rewrite.From, "to": state.Rewrite.To}).Info("approved rewritten history")
+		return nil
+	},
+}
+
+//historyRewritten reports that the head of a branch no longer descends from the applied commit and tells
+//whether sync may apply it. With rewrite-approval the rewrite is recorded in the sync state and held until
+//it is approved
+func historyRewritten(c *cli.Context, b *branch, consulInteractor *consul.ConsulHandler, state *consul.State, from, to string, guards api.KVTxnOps) (bool, error) {
+	log := logrus.WithFields(logrus.Fields{"branch": b.name, "consul-path": b.prefix, "from": from, "to": to})
+	pending := state != nil && state.Rewrite != nil && state.Rewrite.From == from && state.Rewrite.To == to
+	if !pending {
+		log.Warning("history of the branch was rewritten, the head does not descend from the applied commit")
+		consulGitHistoryRewritten.WithLabelValues(b.prefix).Inc()
+		payload, err := json.Marshal(struct {
+			ConsulPath string `json:"consul_path"`
+			Branch     string `json:"branch"`
+			From       string `json:"from"`
+			To         string `json:"to"`
+		}{b.prefix, b.name, from, to})
+		if err != nil {
+			return false, err
+		}
+		if err := consulInteractor.FireEvent(historyRewrittenEvent, payload); err != nil {
+			log.WithError(err).Error("failed firing history rewritten event")
+		}
+	}
+	if !c.Bool("rewrite-approval") || (pending && state.Rewrite.Approved) {
+		return true, nil
+	}
+	if pending {
+		return false, nil
+	}
+	held := newState(b, from)
+	if state != nil {
+		copied := *state
+		held = &copied
+	}
+	held.Rewrite = &consul.Rewrite{From: from, To: to}
+	stateOp, err := consul.StateOp(stateKey(b.prefix), held)
+	if err != nil {
+		return false, err
+	}
+	if err := consulInteractor.ApplyTxn(api.KVTxnOps{stateOp}, consul.TxnReject, guards...); err != nil {
+		return false, err
+	}
+	log.Warning("holding the rewritten history until it is approved with approve-rewrite")
+	return false, nil
+}
@@ -0,0 +1,121 @@
+package command
+
+import (
+	"git2consul/consul"
+	"git2consul/git"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+var rollbackCommand = cli.Command{
+	Name:        "rollback",
+	Usage:       "restore consul to an earlier commit",
+	ArgsUsage:   "--to <sha|tag|HEAD~N>",
+	Description: "diff the commit applied to consul against a revision and apply the difference in one transaction, the working tree of git-dir is left alone. Sync holds the rollback until the branch moves on unless it runs with --roll-forward",
+	Flags: []cli.Flag{
+		&cli.StringFlag{Name: "to", Required: true, Usage: "revision to roll consul back to"},
+		&cli.StringFlag{Name: "lock-key", Value: "git2consul", Usage: "consul key the sync leader holds, the rollback only applies while the holder keeps it"},
+	},
+	Action: func(c *cli.Context) error {
+		setLog(c)
+		if err := validateSignatureFlags(c); err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		r := repoFromFlags(c)
+		b, err := r.branch(c.String("git-branch"))
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		repo := b.repo.open()
+		if repo == nil {
+			return cli.Exit("could not intialize the repo", 1)
+		}
+		consulInteractor, err := consul.NewHandler(consul.Config(c.String("consul-addr"), c.String("consul-token")))
+		if err != nil {
+			consulGitConnectionFailed.Inc()
+			return cli.Exit(err.Error(), 1)
+		}
+		state, err := consulInteractor.ReadState(stateKey(b.prefix))
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		if state == nil {
+			return cli.Exit("consul has no applied commit to roll back from, run a resync first", 1)
+		}
+		to, err := repo.ResolveCommit(b.revision(repo, c.String("to")))
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		if to == state.Commit {
+			logrus.WithField("commit", to).Info("consul is already at the commit")
+			return nil
+		}
+		if err := verifyCommits(c, b, repo, consulInteractor, "", to); err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		diffs, err := repo.Diff(state.Commit, to)
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		if b.filter, err = b.repo.loadFilter(repo, to); err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		if err := b.checkKeys(repo, to); err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		groups := deltaOps(b, repo, diffs, func(diff *git.DiffDelta) []byte {
+			return repo.ReadBlob(diff.NewID)
+		})
+		recorded, err := recordedNormalization(state)
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		if !recorded.equal(b.normalization) {
+			// files the diff does not touch would keep the values of the old policy
+			logrus.WithField("commit", to).Warning("normalize policy changed since the last sync, rewriting every file of the commit")
+			changed := make(map[string]bool, len(diffs))
+			for _, diff := range diffs {
+				changed[diff.NewFile] = true
+			}
+			rewrites, err := commitOps(b, repo, to, changed)
+			if err != nil {
+				return cli.Exit(err.Error(), 1)
+			}
+			groups = append(groups, rewrites...)
+		}
+		rolledBack := newState(b, to)
+		rolledBack.Rollback = &consul.Rollback{From: state.Commit, FromTag: state.Tag, To: c.String("to")}
+		if state.Rollback != nil {
+			// rolling back twice holds the commit the branch was at before the first rollback
+			rolledBack.Rollback.From, rolledBack.Rollback.FromTag = state.Rollback.From, state.Rollback.FromTag
+		}
+		stateOp, err := consul.StateOp(stateKey(b.prefix), rolledBack)
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		groups = append(groups, api.KVTxnOps{stateOp})
+		// a sync that moves the state or takes over the leader lock meanwhile rolls the rollback back
+		guards := api.KVTxnOps{consul.StateGuard(stateKey(b.prefix), state)}
+		leaderGuard, err := consulInteractor.HolderGuard(r.lockKey(c))
+		if err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		if leaderGuard != nil {
+			guards = append(guards, leaderGuard)
+		}
+		ops := flattenOps(groups)
+		if err := consulInteractor.ApplyTxnGroups(groups, consul.TxnPolicy(c.String("txn-policy")), guards...); err != nil {
+			consulGitSyncedFailed.Add(float64(len(ops)))
+			return cli.Exit(err.Error(), 1)
+		}
+		consulGitSynced.Add(float64(len(ops)))
+		logrus.WithFields(logrus.Fields{
+			"from":       state.Commit,
+			"to":         to,
+			"operations": len(ops),
+		}).Info("rolled consul back")
+		return nil
+	},
+}
@@ -1,14 +1,17 @@
 package command
 
 import (
-	"bytes"
+	"fmt"
 	"git2consul/consul"
 	"git2consul/git"
+	"git2consul/webhook"
+	"net/http"
 	"os/exec"
-	"path/filepath"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/hashicorp/consul/api"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
 )
@@ -20,6 +23,21 @@ var syncCommand = cli.Command{
 	Description: "fetch contents changes and sync to consul",
 	Flags: []cli.Flag{
 		&cli.Int64Flag{Name: "since", Value: 30, Usage: "sync interval to consul in seconds"},
+		&cli.BoolFlag{Name: "webhook", Usage: "sync as soon as a github, gitlab, gitea or bitbucket push webhook for the branch arrives on /webhook of the metrics port"},
+		&cli.StringFlag{Name: "webhook-secret", Usage: "secret webhooks are signed with", EnvVars: []string{"GIT2CONSUL_WEBHOOK_SECRET"}},
+		&cli.StringFlag{Name: "tags", Usage: "only sync release tags matching this glob such as config-v*, the highest semantic version is deployed"},
+		&cli.BoolFlag{Name: "prerelease", Usage: "let tags with a prerelease version such as config-v2.0.0-rc.1 be deployed"},
+		&cli.Int64Flag{Name: "drift-interval", Usage: "seconds between checks of consul for keys that drifted from git, checks run after a sync and are off at 0"},
+		&cli.BoolFlag{Name: "drift-heal", Usage: "restore modified and missing keys found by the drift check"},
+		&cli.BoolFlag{Name: "watch", Usage: "follow consul-path with blocking queries and check for drift as soon as a key is written by someone else than git2consul"},
+		&cli.StringFlag{Name: "watch-policy", Value: watchAlert, Usage: "what to do with drift found by watch, revert restores git's values and deletes added keys, alert logs it and fires a git2consul-foreign-write consul event [revert, alert]"},
+		&cli.BoolFlag{Name: "bidirectional", Usage: "commit consul edits of synced keys to an edits branch and push it, git changes to keys edited in consul are reported as conflicts instead of applied"},
+		&cli.StringFlag{Name: "edits-branch-prefix", Value: "consul-edits/", Usage: "prefix of the branch consul edits of a branch are committed to"},
+		&cli.BoolFlag{Name: "roll-forward", Usage: "sync branches and tags that a rollback holds"},
+		&cli.BoolFlag{Name: "replay", Usage: "apply every commit since the last applied one in order as its own transaction instead of the difference to head, each commit is recorded under .git2consul/steps"},
+		&cli.BoolFlag{Name: "rewrite-approval", Usage: "hold branches whose history was rewritten by a force push until an operator runs approve-rewrite"},
+		&cli.BoolFlag{Name: "leader-election", Usage: "only write to consul while holding the lock key so several replicas can run for high availability"},
+		&cli.StringFlag{Name: "lock-key", Value: "git2consul", Usage: "consul key used as the leader lock"},
 		&cli.StringFlag{Name: "commit-id", Value: "", Usage: "git commit id to filter by", EnvVars: []string{"GIT2CONSUL_COMMITID"}, Hidden: true},
 		&cli.StringFlag{Name: "pre-shell", Value: "", Usage: "shell command to execute before syncing", Hidden: true},
 		&cli.StringFlag{Name: "post-shell", Value: "", Usage: "shell command to execute after syncing", Hidden: true}},
@@ -32,84 +50,65 @@ var syncCommand = cli.Command{
 	},
 	Action: func(c *cli.Context) error {
 		setLog(c)
-		if c.Bool("metrics") {
-			metricsInit(c.String("metrics-port"))
-		}
-		gitCollection := git.NewRepository(git.Username(c.String("git-user")),
-			git.Password(c.String("git-password")),
-			git.URL(c.String("git-url")),
-			git.PullDir(c.String("git-dir")),
-			git.PublicKeyPath(c.String("git-ssh-publickey-path")),
-			git.PrivateKeyPath(c.String("git-ssh-privatekey-path")),
-		)
-		if gitCollection == nil {
-			return cli.NewExitError("did not get git repository", 1)
-		}
-		consulGitReads.Inc()
-		tip, err := gitCollection.Repository.Head()
+		repos, err := loadRepos(c)
 		if err != nil {
-			return err
+			return cli.Exit(err.Error(), 1)
 		}
-		startCommit := tip.Target().String()
-		for {
-			time.Sleep(time.Second * time.Duration(c.Int64("since")))
-			logrus.Debug("running sync")
-			gitCollection = gitCollection.Pull(
-				git.CloneOptions(c.String("git-user"),
-					c.String("git-password"),
-					c.String("git-ssh-publickey-path"),
-					c.String("git-ssh-privatekey-path"),
-					c.String("git-ssh-passpharse-path"),
-					[]byte(c.String("git-fingerprint-path"))),
-				c.String("git-remote"), c.String("git-branch"))
-			consulGitReads.Inc()
-			diffDetlas := gitCollection.DifftoHead(startCommit)
-			consulInteractor, err := consul.NewHandler(consul.Config(c.String("consul-addr"), c.String("consul-token")))
-			if err != nil {
-				logrus.WithError(err).Error("failed connecting to consul")
-				consulGitConnectionFailed.Inc()
-				continue
+		if len(repos) == 0 {
+			repos = []*repoConfig{repoFromFlags(c)}
+		}
+		if c.Bool("watch") && c.String("watch-policy") != watchRevert && c.String("watch-policy") != watchAlert {
+			return cli.Exit(fmt.Sprintf("unknown watch-policy %q", c.String("watch-policy")), 1)
+		}
+		if c.Bool("bidirectional") && c.String("tags") != "" {
+			return cli.Exit("bidirectional syncs branches and can not be combined with tags", 1)
+		}
+		if c.Bool("bidirectional") && (c.Bool("drift-heal") || (c.Bool("watch") && c.String("watch-policy") == watchRevert)) {
+			return cli.Exit("bidirectional keeps consul edits and can not be combined with drift-heal or the revert watch-policy", 1)
+		}
+		if err := validateSignatureFlags(c); err != nil {
+			return cli.Exit(err.Error(), 1)
+		}
+		if c.Bool("metrics") {
+			metricsInit()
+		}
+		triggers := make(map[*repoConfig]chan struct{}, len(repos))
+		if c.Bool("webhook") {
+			if c.String("webhook-secret") == "" {
+				return cli.Exit("webhook needs a webhook-secret to verify requests", 1)
+			}
+			for _, repo := range repos {
+				triggers[repo] = make(chan struct{}, 1)
 			}
-			for _, diff := range diffDetlas {
-				consulPath := filepath.Join(c.String("consul-path"), diff.NewFile)
-				consulPath = strings.TrimLeft(consulPath, "/")
-				switch diff.Status {
-				case "Deleted":
-					if ok, err := consulInteractor.Delete(filepath.Join(c.String("consul-path"), diff.OldFile)); err != nil || !ok {
-						logrus.WithError(err).WithFields(
-							logrus.Fields{
-								"old-file":    diff.OldFile,
-								"consul-path": c.String("consul-path"),
-							}).Error("failed adding content")
-						consulGitSyncedFailed.Inc()
+			http.Handle("/webhook", webhook.New(c.String("webhook-secret"), func(push *webhook.Push) {
+				for repo, trigger := range triggers {
+					if !repo.pushed(push, len(repos) == 1) {
 						continue
 					}
-					consulGitSynced.Inc()
-				default:
-					if ok, err := consulInteractor.Put(consulPath, bytes.TrimSpace(gitCollection.ReadFile(c.String("git-dir"), diff.NewFile))); err != nil || !ok {
-						logrus.WithError(err).WithFields(
-							logrus.Fields{
-								"new-file":    diff.NewFile,
-								"consul-path": c.String("consul-path"),
-							}).Error("failed adding content")
-						consulGitSyncedFailed.Inc()
-						continue
+					select {
+					case trigger <- struct{}{}:
+					default:
+						// a sync is already pending
 					}
-					consulGitSynced.Inc()
 				}
-				logrus.WithFields(logrus.Fields{
-					"delta-status": diff.Status,
-					"old-file":     diff.OldFile,
-					"new-file":     diff.NewFile,
-				}).Info("processed delta")
-			}
-			head, err := gitCollection.Head()
-			defer head.Free()
-			if err != nil {
-				logrus.WithError(err).Error("failed to get head after run")
-			}
-			startCommit = head.Target().String()
+			}))
+		}
+		if c.Bool("metrics") || c.Bool("webhook") {
+			serve(c.String("metrics-port"))
 		}
+		if len(repos) == 1 {
+			return syncRepo(c, repos[0], triggers[repos[0]])
+		}
+		var wg sync.WaitGroup
+		for _, repo := range repos {
+			wg.Add(1)
+			go func(repo *repoConfig) {
+				defer wg.Done()
+				supervise(c, repo, triggers[repo])
+			}(repo)
+		}
+		wg.Wait()
+		return nil
 	},
 	After: func(c *cli.Context) error {
 		if c.String("post-shell") != "" {
@@ -118,3 +117,319 @@ var syncCommand = cli.Command{
 		return nil
 	},
 }
+
+//supervise keeps syncing a repository, restarting it after errors and panics so one
+//repository can not stop the others
+func supervise(c *cli.Context, repo *repoConfig, trigger <-chan struct{}) {
+	for {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					logrus.WithFields(logrus.Fields{"repo": repo.Name, "panic": r}).Error("repository sync panicked")
+				}
+			}()
+			if err := syncRepo(c, repo, trigger); err != nil {
+				logrus.WithError(err).WithField("repo", repo.Name).Error("repository sync stopped")
+			}
+		}()
+		time.Sleep(time.Second * time.Duration(repo.Since))
+		logrus.WithField("repo", repo.Name).Info("restarting repository sync")
+	}
+}
+
+//lockKey returns the key the sync leader of the repository holds
+func (r *repoConfig) lockKey(c *cli.Context) string {
+	if r.Name == "" {
+		return c.String("lock-key")
+	}
+	return consulKey(c.String("lock-key"), r.Name)
+}
+
+//syncRepo syncs every branch of a repository on its interval
+func syncRepo(c *cli.Context, repo *repoConfig, trigger <-chan struct{}) error {
+	gitCollection := repo.open()
+	if gitCollection == nil {
+		return cli.NewExitError("did not get git repository", 1)
+	}
+	consulGitReads.Inc()
+	lockKey := repo.lockKey(c)
+	startCommits := map[string]string{}
+	var seenTag string
+	driftChecks := map[string]time.Time{}
+	var foreignWrite int32
+	watched := make(chan struct{}, 1)
+	if c.Bool("watch") {
+		go watch(c, repo, func() {
+			atomic.StoreInt32(&foreignWrite, 1)
+			select {
+			case watched <- struct{}{}:
+			default:
+				// a sync is already pending
+			}
+		})
+	}
+	driftCheck := func(b *branch, consulInteractor *consul.ConsulHandler, guards api.KVTxnOps, foreign bool) {
+		interval := time.Second * time.Duration(c.Int64("drift-interval"))
+		if !foreign && (interval <= 0 || time.Since(driftChecks[b.prefix]) < interval) {
+			return
+		}
+		driftChecks[b.prefix] = time.Now()
+		if err := syncDrift(c, b, gitCollection, consulInteractor, guards, foreign); err != nil {
+			logrus.WithError(err).WithField("consul-path", b.prefix).Error("failed checking drift")
+		}
+	}
+	var leader *consul.Leader
+	for ; ; wait(time.Second*time.Duration(repo.Since), trigger, watched) {
+		logrus.WithField("repo", repo.Name).Debug("running sync")
+		foreign := atomic.SwapInt32(&foreignWrite, 0) == 1
+		consulInteractor, err := consul.NewHandler(consul.Config(c.String("consul-addr"), c.String("consul-token")))
+		if err != nil {
+			logrus.WithError(err).Error("failed connecting to consul")
+			consulGitConnectionFailed.Inc()
+			continue
+		}
+		var guards api.KVTxnOps
+		if c.Bool("leader-election") {
+			if leader == nil {
+				leader = consulInteractor.NewLeader(lockKey)
+			}
+			ok, err := leader.Acquire()
+			if err != nil {
+				logrus.WithError(err).WithField("lock-key", lockKey).Error("failed acquiring leadership")
+			} else if !ok {
+				logrus.WithField("lock-key", lockKey).Debug("following, another git2consul holds the lock")
+			}
+			if ok {
+				guards = append(guards, leader.Guard())
+			}
+		}
+		if repo.Tags != "" {
+			if leader != nil && !leader.IsLeader() {
+				seenTag = ""
+				continue
+			}
+			consulGitReads.Inc()
+			if seenTag, err = syncTag(c, repo, gitCollection, consulInteractor, seenTag, guards); err != nil {
+				logrus.WithError(err).WithField("repo", repo.Name).Error("failed deploying release tag, retrying on the next sync")
+			} else if seenTag != "" {
+				if b, err := repo.tagBranch(); err == nil {
+					driftCheck(b, consulInteractor, guards, foreign)
+				}
+			}
+			continue
+		}
+		branches, err := repo.resolveBranches(gitCollection)
+		if err != nil {
+			logrus.WithError(err).WithField("repo", repo.Name).Error("failed resolving branches")
+			continue
+		}
+		prefixes := map[string]string{}
+		for _, name := range branches {
+			log := logrus.WithFields(logrus.Fields{"repo": repo.Name, "branch": name})
+			gitCollection = repo.pull(gitCollection, name)
+			consulGitReads.Inc()
+			if !gitCollection.CheckedOut(name) {
+				log.Error("branch is not checked out, skipping it")
+				continue
+			}
+			if leader != nil && !leader.IsLeader() {
+				// followers keep the clone warm, the leader moves the state on so read it again once leading
+				startCommits[name] = ""
+				continue
+			}
+			b, err := repo.branch(name)
+			if err != nil {
+				log.WithError(err).Error("failed mapping branch to a consul path")
+				continue
+			}
+			if other, ok := prefixes[b.prefix]; ok {
+				log.WithFields(logrus.Fields{"prefix": b.prefix, "other": other}).Error("branch maps to the same consul path as another branch, skipping it")
+				continue
+			}
+			prefixes[b.prefix] = name
+			startCommit, err := syncBranch(c, b, gitCollection, consulInteractor, startCommits[name], guards)
+			if err != nil {
+				log.WithError(err).Error("failed applying changes, retrying on the next sync")
+			} else {
+				driftCheck(b, consulInteractor, guards, foreign)
+			}
+			startCommits[name] = startCommit
+		}
+	}
+}
+
+//syncBranch applies the changes of the checked out branch since startCommit and returns the commit consul is at
+func syncBranch(c *cli.Context, b *branch, gitCollection *git.Collection, consulInteractor *consul.ConsulHandler, startCommit string, guards api.KVTxnOps) (string, error) {
+	head, err := gitCollection.Head()
+	if err != nil {
+		return startCommit, err
+	}
+	headCommit := head.Target().String()
+	head.Free()
+	state, err := consulInteractor.ReadState(stateKey(b.prefix))
+	if err != nil {
+		return startCommit, err
+	}
+	if state != nil && state.Rollback != nil && state.Rollback.From == headCommit && !c.Bool("roll-forward") {
+		log := logrus.WithFields(logrus.Fields{"branch": b.name, "commit": state.Commit, "rolled-back-from": headCommit})
+		if state.Commit != startCommit {
+			log.Info("holding rollback until the branch moves on, sync with --roll-forward to apply the branch again")
+		}
+		return state.Commit, nil
+	}
+	if state != nil && state.Commit != startCommit {
+		// consul was moved by someone else such as a rollback
+		startCommit = ""
+	}
+	if startCommit == "" {
+		if startCommit, err = resume(c, b, gitCollection, consulInteractor, guards...); err != nil {
+			return "", err
+		}
+	}
+	if !gitCollection.HasCommit(startCommit) {
+		// the applied commit was rewritten away and is gone from the clone, there is no tree to diff from
+		logrus.WithFields(logrus.Fields{"branch": b.name, "commit": startCommit}).Warning("applied commit no longer exists, running a full resync")
+		return resync(c, b, gitCollection, consulInteractor, guards...)
+	}
+	var a *applied
+	var pairs map[string]*api.KVPair
+	if c.Bool("bidirectional") {
+		if a, err = readApplied(b, gitCollection, startCommit, state); err != nil {
+			return startCommit, err
+		}
+		if pairs, err = listManaged(b, consulInteractor); err != nil {
+			return startCommit, err
+		}
+		if err := captureEdits(c, b, gitCollection, a, pairs); err != nil {
+			logrus.WithError(err).WithField("branch", b.name).Error("failed committing consul edits")
+		}
+	}
+	if state != nil && state.Commit == startCommit {
+		recorded, err := recordedNormalization(state)
+		if err != nil {
+			return startCommit, err
+		}
+		if !recorded.equal(b.normalization) {
+			// files the next diff does not touch would keep the values of the old policy
+			logrus.WithFields(logrus.Fields{"branch": b.name, "commit": startCommit}).Warning("normalize policy changed since the last sync, resyncing the applied commit")
+			if _, err := resyncCommit(c, b, gitCollection, consulInteractor, startCommit, guards...); err != nil {
+				return startCommit, err
+			}
+			if a != nil {
+				if a, err = readApplied(b, gitCollection, startCommit, nil); err != nil {
+					return startCommit, err
+				}
+				if pairs, err = listManaged(b, consulInteractor); err != nil {
+					return startCommit, err
+				}
+			}
+		}
+	}
+	if headCommit == startCommit {
+		return startCommit, nil
+	}
+	rewritten := !gitCollection.IsReachable(startCommit)
+	if rewritten {
+		proceed, err := historyRewritten(c, b, consulInteractor, state, startCommit, headCommit, guards)
+		if err != nil || !proceed {
+			return startCommit, err
+		}
+	}
+	if err := verifyCommits(c, b, gitCollection, consulInteractor, startCommit, headCommit); err != nil {
+		return startCommit, err
+	}
+	if c.Bool("replay") && b.name != "" {
+		if !rewritten {
+			return replay(c, b, gitCollection, consulInteractor, startCommit, a, pairs, guards)
+		}
+		logrus.WithField("branch", b.name).Warning("a rewritten history cannot be replayed, applying the new head in one step")
+	}
+	if err := applyCommit(c, b, gitCollection, consulInteractor, startCommit, headCommit, a, pairs, nil, guards); err != nil {
+		return startCommit, err
+	}
+	return headCommit, nil
+}
+
+//applyCommit applies the difference between two commits to consul in one transaction together with the sync
+//state and, when replaying, the step of the commit. With bidirectional sync keys edited in consul since a
+//are left alone and recorded as conflicts
+func applyCommit(c *cli.Context, b *branch, gitCollection *git.Collection, consulInteractor *consul.ConsulHandler, from, to string, a *applied, pairs map[string]*api.KVPair, step *consul.Step, guards api.KVTxnOps) error {
+	var err error
+	if b.filter, err = b.repo.loadFilter(gitCollection, to); err != nil {
+		return err
+	}
+	if err := b.checkKeys(gitCollection, to); err != nil {
+		return err
+	}
+	// the trees are diffed directly so a rewritten history applies the difference to the last applied tree
+	diffDetlas, err := gitCollection.Diff(from, to)
+	if err != nil {
+		return err
+	}
+	groups := deltaOps(b, gitCollection, diffDetlas, func(diff *git.DiffDelta) []byte {
+		return gitCollection.ReadBlob(diff.NewID)
+	})
+	headState := newState(b, to)
+	if a != nil {
+		groups, headState.Conflicts = casGroups(groups, a, pairs)
+		for _, key := range headState.Conflicts {
+			logrus.WithFields(logrus.Fields{"key": key, "commit": to}).Error("key was edited in consul, keeping the consul value instead of applying git")
+		}
+		consulGitConflicts.WithLabelValues(b.prefix).Set(float64(len(headState.Conflicts)))
+	}
+	if step != nil {
+		step.Operations = len(flattenOps(groups))
+		step.Conflicts = headState.Conflicts
+		stepOp, err := consul.StepOp(stepKey(b.prefix, to), step)
+		if err != nil {
+			return err
+		}
+		groups = append(groups, api.KVTxnOps{stepOp})
+	}
+	stateOp, err := consul.StateOp(stateKey(b.prefix), headState)
+	if err != nil {
+		return err
+	}
+	groups = append(groups, api.KVTxnOps{stateOp})
+	ops := flattenOps(groups)
+	if err := consulInteractor.ApplyTxnGroups(groups, consul.TxnPolicy(c.String("txn-policy")), guards...); err != nil {
+		consulGitSyncedFailed.Add(float64(len(ops)))
+		return err
+	}
+	consulGitSynced.Add(float64(len(ops)))
+	return nil
+}
+
+//wait blocks for the sync interval or until a webhook or the watcher triggers a sync
+func wait(interval time.Duration, trigger, watched <-chan struct{}) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-trigger:
+		logrus.Debug("sync triggered by webhook")
+	case <-watched:
+		logrus.Debug("sync triggered by a foreign write")
+	}
+}
+
+//resume returns the commit recorded in the sync state to diff from. A full resync is run
+//when there is no state or the recorded commit is gone from the clone, a commit rewritten out of the history of head is still diffed from
+func resume(c *cli.Context, b *branch, gitCollection *git.Collection, consulInteractor *consul.ConsulHandler, guards ...*api.KVTxnOp) (string, error) {
+	state, err := consulInteractor.ReadState(stateKey(b.prefix))
+	if err != nil {
+		return "", err
+	}
+	if state != nil && gitCollection.HasCommit(state.Commit) {
+		logrus.WithFields(logrus.Fields{
+			"commit":    state.Commit,
+			"branch":    b.name,
+			"timestamp": state.Timestamp,
+		}).Info("resuming sync from last applied commit")
+		return state.Commit, nil
+	}
+	if state != nil {
+		logrus.WithField("commit", state.Commit).Warning("last applied commit does not exist, running a full resync")
+	}
+	return resync(c, b, gitCollection, consulInteractor, guards...)
+}
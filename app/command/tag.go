@@ -0,0 +1,94 @@
+package command
+
+import (
+	"git2consul/consul"
+	"git2consul/git"
+	"git2consul/semver"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+//syncTag applies the highest release tag matching the tag pattern of the repository when it is newer than
+//the tag recorded in consul. The tag it looked at is returned so consul is only read again once it changes
+func syncTag(c *cli.Context, repo *repoConfig, gitCollection *git.Collection, consulInteractor *consul.ConsulHandler, seen string, guards api.KVTxnOps) (string, error) {
+	tags, err := gitCollection.Tags(repo.cloneOptions(), repo.Remote, repo.Tags)
+	if err != nil {
+		return seen, err
+	}
+	tag, ok := semver.Highest(tags, repo.Prerelease)
+	if !ok {
+		logrus.WithField("pattern", repo.Tags).Debug("no release tag matches")
+		return seen, nil
+	}
+	if tag == seen {
+		return seen, nil
+	}
+	b, err := repo.tagBranch()
+	if err != nil {
+		return seen, err
+	}
+	state, err := consulInteractor.ReadState(stateKey(b.prefix))
+	if err != nil {
+		return seen, err
+	}
+	log := logrus.WithFields(logrus.Fields{"repo": repo.Name, "tag": tag})
+	var from string
+	if state != nil {
+		if state.Tag == tag {
+			return tag, nil
+		}
+		if state.Rollback != nil && state.Rollback.FromTag == tag && !c.Bool("roll-forward") {
+			log.WithField("commit", state.Commit).Info("holding rollback until a newer tag is pushed, sync with --roll-forward to deploy the tag again")
+			return tag, nil
+		}
+		if deployed, ok := semver.Parse(state.Tag); ok {
+			if next, _ := semver.Parse(tag); next.Compare(deployed) <= 0 {
+				log.WithField("deployed", state.Tag).Warning("highest release tag is not newer than the deployed tag, not syncing")
+				return tag, nil
+			}
+		}
+		if _, err := gitCollection.ResolveCommit(state.Commit); err == nil {
+			from = state.Commit
+		} else {
+			log.WithField("commit", state.Commit).Warning("deployed commit is missing, writing every file of the tag")
+		}
+	}
+	to, err := gitCollection.ResolveCommit("refs/tags/" + tag)
+	if err != nil {
+		return seen, err
+	}
+	if err := verifyCommits(c, b, gitCollection, consulInteractor, from, to); err != nil {
+		return seen, err
+	}
+	diffs, err := gitCollection.Diff(from, to)
+	if err != nil {
+		return seen, errors.Wrapf(err, "failed diffing tag %s", tag)
+	}
+	if b.filter, err = repo.loadFilter(gitCollection, to); err != nil {
+		return seen, err
+	}
+	if err := b.checkKeys(gitCollection, to); err != nil {
+		return seen, err
+	}
+	groups := deltaOps(b, gitCollection, diffs, func(diff *git.DiffDelta) []byte {
+		return gitCollection.ReadBlob(diff.NewID)
+	})
+	deployedState := newState(b, to)
+	deployedState.Tag = tag
+	stateOp, err := consul.StateOp(stateKey(b.prefix), deployedState)
+	if err != nil {
+		return seen, err
+	}
+	groups = append(groups, api.KVTxnOps{stateOp})
+	ops := flattenOps(groups)
+	if err := consulInteractor.ApplyTxnGroups(groups, consul.TxnPolicy(c.String("txn-policy")), guards...); err != nil {
+		consulGitSyncedFailed.Add(float64(len(ops)))
+		return seen, err
+	}
+	consulGitSynced.Add(float64(len(ops)))
+	log.WithField("commit", to).Info("deployed release tag")
+	return tag, nil
+}
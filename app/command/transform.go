@@ -0,0 +1,139 @@
+package command
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"git2consul/git"
+
+	"github.com/pkg/errors"
+)
+
+//rewrite replaces the matches of a regular expression in a key
+type rewrite struct {
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+//keyTransform turns the path of a file below its mountpoint into the rest of its consul key
+type keyTransform struct {
+	// extensions stripped from file names, * strips any extension
+	extensions []string
+	rewrites   []rewrite
+	// splitDots turns the dots of file names into folders
+	splitDots bool
+	// keyCase is lower, upper or empty to keep the case
+	keyCase string
+}
+
+//parseRewrite reads a rewrite written as pattern=>replacement
+func parseRewrite(s string) (rewrite, error) {
+	i := strings.Index(s, "=>")
+	if i < 0 {
+		return rewrite{}, errors.Errorf("key rewrite %q needs to be written as pattern=>replacement", s)
+	}
+	pattern, err := regexp.Compile(s[:i])
+	if err != nil {
+		return rewrite{}, errors.Wrapf(err, "failed compiling key rewrite %q", s)
+	}
+	return rewrite{pattern: pattern, replacement: s[i+2:]}, nil
+}
+
+//transform returns the key transformation of the repository
+func (r *repoConfig) transform() (*keyTransform, error) {
+	t := &keyTransform{extensions: r.KeyStripExtensions, splitDots: r.KeySplitDots, keyCase: r.KeyCase}
+	switch t.keyCase {
+	case "", "lower", "upper":
+	default:
+		return nil, errors.Errorf("key-case needs to be lower or upper, got %q", t.keyCase)
+	}
+	for _, s := range r.KeyRewrites {
+		rw, err := parseRewrite(s)
+		if err != nil {
+			return nil, err
+		}
+		t.rewrites = append(t.rewrites, rw)
+	}
+	return t, nil
+}
+
+//empty tells whether the transformation keeps every path as it is
+func (t *keyTransform) empty() bool {
+	return t == nil || (len(t.extensions) == 0 && len(t.rewrites) == 0 && !t.splitDots && t.keyCase == "")
+}
+
+//apply transforms a path in order: extensions are stripped from the file name, rewrites run on the
+//whole path, dots of the file name become folders and the case is normalized last
+func (t *keyTransform) apply(rel string) string {
+	if t.empty() || rel == "" {
+		return rel
+	}
+	dir, name := path.Split(rel)
+	for _, ext := range t.extensions {
+		if ext == "*" {
+			if e := path.Ext(name); e != name {
+				name = strings.TrimSuffix(name, e)
+			}
+			break
+		}
+		ext = "." + strings.TrimPrefix(ext, ".")
+		if strings.HasSuffix(name, ext) && name != ext {
+			name = strings.TrimSuffix(name, ext)
+			break
+		}
+	}
+	rel = dir + name
+	for _, rw := range t.rewrites {
+		rel = rw.pattern.ReplaceAllString(rel, rw.replacement)
+	}
+	if t.splitDots {
+		dir, name = path.Split(rel)
+		rel = dir + strings.Trim(strings.Replace(name, ".", "/", -1), "/")
+	}
+	switch t.keyCase {
+	case "lower":
+		rel = strings.ToLower(rel)
+	case "upper":
+		rel = strings.ToUpper(rel)
+	}
+	return strings.Trim(path.Clean("/"+rel), "/")
+}
+
+//checkKeys fails when two files of a revision that are synced by the branch write the same consul key,
+//including the keys of expanded files
+func (b *branch) checkKeys(gitCollection *git.Collection, revision string) error {
+	diffs, err := gitCollection.Diff("", revision)
+	if err != nil {
+		return err
+	}
+	owners := map[string]string{}
+	var collisions []string
+	for _, diff := range diffs {
+		key, mapped := b.key(diff.NewFile)
+		if !diff.NewIsFile() || !mapped || !b.filter.allows(diff.NewFile) {
+			continue
+		}
+		keys := []string{key}
+		if b.repo.ExpandKeys {
+			keys = keys[:0]
+			for key := range fileKeys(b, key, diff.NewFile, gitCollection.ReadBlob(diff.NewID)) {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+		}
+		for _, key := range keys {
+			if owner, ok := owners[key]; ok {
+				collisions = append(collisions, owner+" and "+diff.NewFile+" both sync to "+key)
+				continue
+			}
+			owners[key] = diff.NewFile
+		}
+	}
+	if len(collisions) > 0 {
+		sort.Strings(collisions)
+		return errors.Errorf("transformed keys collide: %s", strings.Join(collisions, ", "))
+	}
+	return nil
+}
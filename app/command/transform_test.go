@@ -0,0 +1,107 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeyTransformApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		repo     *repoConfig
+		path     string
+		expected string
+	}{
+		{name: "no rules", repo: &repoConfig{}, path: "db/Config.yml", expected: "db/Config.yml"},
+		{name: "strip extension", repo: &repoConfig{KeyStripExtensions: []string{"yml", ".json"}}, path: "db/config.json", expected: "db/config"},
+		{name: "strip only the listed extension", repo: &repoConfig{KeyStripExtensions: []string{"yml"}}, path: "db/config.json", expected: "db/config.json"},
+		{name: "strip any extension", repo: &repoConfig{KeyStripExtensions: []string{"*"}}, path: "db/config.prod.yml", expected: "db/config.prod"},
+		{name: "keep dot files", repo: &repoConfig{KeyStripExtensions: []string{"*", "env"}}, path: "db/.env", expected: "db/.env"},
+		{name: "rewrite", repo: &repoConfig{KeyRewrites: []string{"^env/(\\w+)/=>$1/"}}, path: "env/prod/db", expected: "prod/db"},
+		{name: "rewrites run in order", repo: &repoConfig{KeyRewrites: []string{"a=>b", "b=>c"}}, path: "a/b", expected: "c/c"},
+		{name: "split dots", repo: &repoConfig{KeySplitDots: true}, path: "app.d/db.host", expected: "app.d/db/host"},
+		{name: "lower case", repo: &repoConfig{KeyCase: "lower"}, path: "DB/Host", expected: "db/host"},
+		{name: "upper case", repo: &repoConfig{KeyCase: "upper"}, path: "db/host", expected: "DB/HOST"},
+		{
+			name:     "rules apply in order",
+			repo:     &repoConfig{KeyStripExtensions: []string{"yml"}, KeyRewrites: []string{"^conf/=>"}, KeySplitDots: true, KeyCase: "lower"},
+			path:     "conf/DB.Primary.yml",
+			expected: "db/primary",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			transform, err := test.repo.transform()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key := transform.apply(test.path); key != test.expected {
+				t.Errorf("expected %s to become %s, got %s", test.path, test.expected, key)
+			}
+		})
+	}
+}
+
+func TestTransformInvalid(t *testing.T) {
+	for _, repo := range []*repoConfig{{KeyCase: "title"}, {KeyRewrites: []string{"no-replacement"}}, {KeyRewrites: []string{"(=>x"}}} {
+		if _, err := repo.transform(); err == nil {
+			t.Errorf("expected %+v to be refused", repo)
+		}
+	}
+}
+
+func TestCheckKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		repo    *repoConfig
+		files   map[string]string
+		collide string
+	}{
+		{
+			name:  "distinct keys",
+			repo:  &repoConfig{KeyStripExtensions: []string{"yml"}},
+			files: map[string]string{"a.yml": "1", "b.yml": "2"},
+		},
+		{
+			name:    "stripped extensions collide",
+			repo:    &repoConfig{KeyStripExtensions: []string{"*"}},
+			files:   map[string]string{"a.json": "{}", "a.yml": "a: 1"},
+			collide: "a.json and a.yml both sync to app/a",
+		},
+		{
+			name:    "case collides",
+			repo:    &repoConfig{KeyCase: "lower"},
+			files:   map[string]string{"A": "1", "a": "2"},
+			collide: "A and a both sync to app/a",
+		},
+		{
+			name:    "expanded key collides with a file",
+			repo:    &repoConfig{ExpandKeys: true, KeyStripExtensions: []string{"json"}, KeySplitDots: true},
+			files:   map[string]string{"db.json": `{"host": "db"}`, "db.host": "localhost"},
+			collide: "both sync to app/db/host",
+		},
+		{
+			name:  "expanded keys next to a file",
+			repo:  &repoConfig{ExpandKeys: true, KeyStripExtensions: []string{"json"}},
+			files: map[string]string{"db.json": `{"host": "db"}`, "db": "localhost"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repo, cleanup := newTestRepo(t, false)
+			defer cleanup()
+			commit := repo.commit(test.files, nil, "test")
+
+			err := testBranch(t, test.repo, "app").checkKeys(repo.collection(), commit)
+			if test.collide == "" {
+				if err != nil {
+					t.Errorf("expected no collisions, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.collide) {
+				t.Errorf("expected the keys to collide with %q, got %v", test.collide, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package command
+
+import (
+	"encoding/json"
+	"sync"
+
+	"git2consul/consul"
+	"git2consul/git"
+	"git2consul/signature"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	//verifyTip only requires the head commit to be signed
+	verifyTip = "tip"
+	//verifyAll requires every commit being applied to be signed
+	verifyAll = "all"
+)
+
+//unverifiedCommitEvent is the consul user event fired when sync refuses a commit without a trusted signature
+const unverifiedCommitEvent = "git2consul-unverified-commit"
+
+//refused remembers the commit last refused per consul path so a held commit is alerted once
+var refused = struct {
+	sync.Mutex
+	commits map[string]string
+}{commits: map[string]string{}}
+
+//validateSignatureFlags checks the require-signatures flags of the commands writing to consul
+func validateSignatureFlags(c *cli.Context) error {
+	switch c.String("require-signatures") {
+	case "":
+		return nil
+	case verifyTip, verifyAll:
+	default:
+		return errors.Errorf("require-signatures needs to be %s or %s", verifyTip, verifyAll)
+	}
+	if c.String("gpg-keyring") == "" && c.String("ssh-allowed-signers") == "" {
+		return errors.New("require-signatures needs a gpg-keyring or ssh-allowed-signers to trust")
+	}
+	return nil
+}
+
+//verifyCommits refuses to apply commits that are not signed by a trusted key. With require-signatures=all every
+//commit reachable from to but not from from is checked, including the commits of merged branches. Otherwise or
+//when there is nothing to list from only to is
+func verifyCommits(c *cli.Context, b *branch, gitCollection *git.Collection, consulInteractor *consul.ConsulHandler, from, to string) error {
+	mode := c.String("require-signatures")
+	if mode == "" {
+		return nil
+	}
+	verifier, err := signature.Load(c.String("gpg-keyring"), c.String("ssh-allowed-signers"))
+	if err != nil {
+		return err
+	}
+	commits := []string{to}
+	if mode == verifyAll && from != "" {
+		between, err := gitCollection.CommitsBetween(from, to)
+		if err != nil {
+			return err
+		}
+		// a branch moved back to an ancestor of from has nothing in between, its head is still checked
+		if len(between) > 0 {
+			commits = commits[:0]
+		}
+		for _, commit := range between {
+			commits = append(commits, commit.ID)
+		}
+	}
+	for _, commit := range commits {
+		sig, signed, err := gitCollection.CommitSignature(commit)
+		if err != nil {
+			return err
+		}
+		signer, err := verifier.Verify([]byte(sig), []byte(signed))
+		if err != nil {
+			refuse(b, consulInteractor, commit, err)
+			return errors.Wrapf(err, "refusing commit %s", commit)
+		}
+		logrus.WithFields(logrus.Fields{"commit": commit, "signer": signer}).Debug("verified commit signature")
+	}
+	refused.Lock()
+	delete(refused.commits, b.prefix)
+	refused.Unlock()
+	return nil
+}
+
+//refuse counts a refused commit and fires an event about it the first time it is refused
+func refuse(b *branch, consulInteractor *consul.ConsulHandler, commit string, reason error) {
+	consulGitUnverifiedCommits.WithLabelValues(b.prefix).Inc()
+	refused.Lock()
+	alerted := refused.commits[b.prefix] == commit
+	refused.commits[b.prefix] = commit
+	refused.Unlock()
+	log := logrus.WithFields(logrus.Fields{"branch": b.name, "consul-path": b.prefix, "commit": commit})
+	if alerted {
+		return
+	}
+	log.WithError(reason).Error("commit is not signed by a trusted key, holding the branch")
+	payload, err := json.Marshal(struct {
+		ConsulPath string `json:"consul_path"`
+		Branch     string `json:"branch"`
+		Commit     string `json:"commit"`
+		Reason     string `json:"reason"`
+	}{b.prefix, b.name, commit, reason.Error()})
+	if err != nil {
+		return
+	}
+	if err := consulInteractor.FireEvent(unverifiedCommitEvent, payload); err != nil {
+		log.WithError(err).Error("failed firing unverified commit event")
+	}
+}
@@ -0,0 +1,95 @@
+package command
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"git2consul/consul"
+
+	git2go "github.com/libgit2/git2go/v29"
+	"golang.org/x/crypto/ssh"
+)
+
+//trustKey generates a signing key and writes it to an allowed signers file in the repository directory
+func trustKey(t *testing.T, repo *testRepo) (ed25519.PrivateKey, string) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := ssh.NewPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := repo.dir + "/allowed_signers"
+	if err := ioutil.WriteFile(path, append([]byte("ops@example.com "), ssh.MarshalAuthorizedKey(publicKey)...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return private, path
+}
+
+func TestVerifyCommitsMergedUnsignedCommit(t *testing.T) {
+	repo, cleanup := newTestRepo(t, false)
+	defer cleanup()
+	key, allowedSigners := trustKey(t, repo)
+	base := repo.commit(nil, key, "base")
+	side := repo.commit(nil, nil, "unsigned side commit", base)
+	mainline := repo.commit(nil, key, "mainline", base)
+	merge := repo.commit(nil, key, "merge", mainline, side)
+
+	consulInteractor, err := consul.NewHandler(consul.Config("127.0.0.1:1", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := testBranch(t, &repoConfig{}, "app")
+	for _, mode := range []string{verifyTip, verifyAll} {
+		c := testContext(map[string]string{"require-signatures": mode, "gpg-keyring": "", "ssh-allowed-signers": allowedSigners})
+		err := verifyCommits(c, b, repo.collection(), consulInteractor, base, merge)
+		switch {
+		case mode == verifyTip && err != nil:
+			t.Errorf("expected the signed head to pass with %s, got %v", mode, err)
+		case mode == verifyAll && (err == nil || !strings.Contains(err.Error(), side)):
+			t.Errorf("expected the merged side commit %s to be refused with %s, got %v", side, mode, err)
+		}
+	}
+}
+
+func TestVerifyCommitsTagAboveUnsignedCommit(t *testing.T) {
+	repo, cleanup := newTestRepo(t, false)
+	defer cleanup()
+	key, allowedSigners := trustKey(t, repo)
+	deployed := repo.commit(nil, key, "v1.0.0")
+	unsigned := repo.commit(nil, nil, "unsigned commit", deployed)
+	tagged := repo.commit(nil, key, "v1.1.0", unsigned)
+	id, err := git2go.NewOid(tagged)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit, err := repo.LookupCommit(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer commit.Free()
+	if _, err := repo.Tags.CreateLightweight("v1.1.0", commit, false); err != nil {
+		t.Fatal(err)
+	}
+	to, err := repo.collection().ResolveCommit("refs/tags/v1.1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	consulInteractor, err := consul.NewHandler(consul.Config("127.0.0.1:1", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := testContext(map[string]string{"require-signatures": verifyAll, "gpg-keyring": "", "ssh-allowed-signers": allowedSigners})
+	b, err := (&repoConfig{}).tagBranch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyCommits(c, b, repo.collection(), consulInteractor, deployed, to); err == nil || !strings.Contains(err.Error(), unsigned) {
+		t.Errorf("expected the unsigned commit %s below the tag to be refused, got %v", unsigned, err)
+	}
+}
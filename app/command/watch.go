@@ -0,0 +1,77 @@
+package command
+
+import (
+	"encoding/json"
+	"time"
+
+	"git2consul/consul"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	//watchRevert restores keys written by someone else than git2consul
+	watchRevert = "revert"
+	//watchAlert reports keys written by someone else than git2consul
+	watchAlert = "alert"
+)
+
+//foreignWriteEvent is the consul user event fired when the watcher finds drift
+const foreignWriteEvent = "git2consul-foreign-write"
+
+//watch follows the consul path of a repository with blocking queries and calls notify when
+//a key is written by someone else than git2consul. It never returns
+func watch(c *cli.Context, repo *repoConfig, notify func()) {
+	prefix := consulPrefix(repo.ConsulPath)
+	log := logrus.WithFields(logrus.Fields{"repo": repo.Name, "prefix": prefix})
+	var watcher *consul.Watcher
+	for {
+		if watcher == nil {
+			consulInteractor, err := consul.NewHandler(consul.Config(c.String("consul-addr"), c.String("consul-token")))
+			if err != nil {
+				log.WithError(err).Error("failed connecting to consul")
+				consulGitConnectionFailed.Inc()
+				time.Sleep(time.Second * time.Duration(repo.Since))
+				continue
+			}
+			watcher = consulInteractor.NewWatcher(prefix)
+			log.Info("watching consul for foreign writes")
+		}
+		writes, err := watcher.Next()
+		if err != nil {
+			log.WithError(err).Error("failed watching consul")
+			time.Sleep(time.Second * time.Duration(repo.Since))
+			continue
+		}
+		for _, write := range writes {
+			log.WithFields(logrus.Fields{
+				"key":          write.Key,
+				"deleted":      write.Deleted,
+				"modify-index": write.ModifyIndex,
+			}).Info("consul key changed outside of git2consul")
+		}
+		if len(writes) > 0 {
+			notify()
+		}
+	}
+}
+
+//alert fires a consul user event about drift found after a foreign write
+func alert(consulInteractor *consul.ConsulHandler, report *driftReport) error {
+	if len(report.Drifts) == 0 {
+		return nil
+	}
+	counts := report.counts()
+	payload, err := json.Marshal(struct {
+		ConsulPath string `json:"consul_path"`
+		Commit     string `json:"commit"`
+		Modified   int    `json:"modified"`
+		Missing    int    `json:"missing"`
+		Extra      int    `json:"extra"`
+	}{report.ConsulPath, report.Commit, counts[driftModified], counts[driftMissing], counts[driftExtra]})
+	if err != nil {
+		return err
+	}
+	return consulInteractor.FireEvent(foreignWriteEvent, payload)
+}
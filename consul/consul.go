@@ -2,8 +2,11 @@ package consul
 
 import (
 	"crypto/tls"
+	"encoding/json"
+	"fmt"
 	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -226,6 +229,24 @@ func (c *ConsulHandler) read(path string) ([]byte, error) {
 	return kvPair.Value, nil
 }
 
+//Keys lists every key under prefix
+func (c *ConsulHandler) Keys(prefix string) ([]string, error) {
+	keys, _, err := c.Client.KV().Keys(prefix, "", &api.QueryOptions{Token: c.opts.Config.Token})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed listing keys under %s", prefix)
+	}
+	return keys, nil
+}
+
+//List returns every key and value under prefix
+func (c *ConsulHandler) List(prefix string) (api.KVPairs, error) {
+	kvPairs, _, err := c.Client.KV().List(prefix, &api.QueryOptions{Token: c.opts.Config.Token})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed listing %s", prefix)
+	}
+	return kvPairs, nil
+}
+
 //Put content in Consul
 func (c *ConsulHandler) Put(path string, value []byte) (bool, error) {
 	consulKV := c.Client.KV()
@@ -246,6 +267,193 @@ func (c *ConsulHandler) Delete(path string) (bool, error) {
 	return true, nil
 }
 
+//MaxTxnOps is the most operations consul accepts in a single transaction
+const MaxTxnOps = 64
+
+//TxnPolicy decides how changes larger than a single transaction are applied
+type TxnPolicy string
+
+const (
+	//TxnSplit applies large changes as consecutive transactions of at most MaxTxnOps
+	TxnSplit TxnPolicy = "split"
+	//TxnReject refuses changes that do not fit in a single transaction
+	TxnReject TxnPolicy = "reject"
+)
+
+//ApplyTxn applies kv operations through the consul transaction api. Each batch of
+//MaxTxnOps is atomic, batches are applied in order and stop at the first failure.
+//Guards are checked in every batch so a batch only applies while they hold
+func (c *ConsulHandler) ApplyTxn(ops api.KVTxnOps, policy TxnPolicy, guards ...*api.KVTxnOp) error {
+	groups := make([]api.KVTxnOps, len(ops))
+	for i, op := range ops {
+		groups[i] = api.KVTxnOps{op}
+	}
+	return c.ApplyTxnGroups(groups, policy, guards...)
+}
+
+//ApplyTxnGroups works like ApplyTxn but never splits a group of operations across
+//batches, such as the delete and set of a renamed file
+func (c *ConsulHandler) ApplyTxnGroups(groups []api.KVTxnOps, policy TxnPolicy, guards ...*api.KVTxnOp) error {
+	size := MaxTxnOps - len(guards)
+	total := 0
+	for _, group := range groups {
+		if len(group) > size {
+			return errors.Errorf("%d operations that must be applied together do not fit in a single transaction of %d", len(group), size)
+		}
+		total += len(group)
+	}
+	switch policy {
+	case TxnSplit:
+	case TxnReject:
+		if total > size {
+			return errors.Errorf("%d operations do not fit in a single transaction of %d", total, size)
+		}
+	default:
+		return errors.Errorf("unknown transaction policy %q", policy)
+	}
+	start := 0
+	for len(groups) > 0 {
+		batch := append(api.KVTxnOps{}, guards...)
+		for len(groups) > 0 && len(batch)+len(groups[0]) <= MaxTxnOps {
+			batch = append(batch, groups[0]...)
+			groups = groups[1:]
+		}
+		end := start + len(batch) - len(guards)
+		ok, resp, _, err := c.Client.KV().Txn(batch, &api.QueryOptions{Token: c.opts.Config.Token})
+		if err != nil {
+			return errors.Wrapf(err, "failed applying operations %d to %d", start, end)
+		}
+		if !ok {
+			return txnError(resp, start, guards)
+		}
+		ownWrites.record(batch, resp)
+		start = end
+	}
+	return nil
+}
+
+func txnError(resp *api.KVTxnResponse, offset int, guards api.KVTxnOps) error {
+	if resp == nil || len(resp.Errors) == 0 {
+		return errors.Errorf("transaction starting at operation %d was rolled back", offset)
+	}
+	var msgs []string
+	for _, txnErr := range resp.Errors {
+		if txnErr.OpIndex < len(guards) {
+			msgs = append(msgs, fmt.Sprintf("%s %s: %s", guards[txnErr.OpIndex].Verb, guards[txnErr.OpIndex].Key, txnErr.What))
+			continue
+		}
+		msgs = append(msgs, fmt.Sprintf("operation %d: %s", offset+txnErr.OpIndex-len(guards), txnErr.What))
+	}
+	return errors.Errorf("transaction was rolled back: %s", strings.Join(msgs, ", "))
+}
+
+//StateKey is where the sync state is kept relative to the consul path
+const StateKey = ".git2consul/state"
+
+//State records the last commit that was fully applied to consul
+type State struct {
+	Commit     string    `json:"commit"`
+	Repository string    `json:"repository"`
+	Branch     string    `json:"branch"`
+	Tag        string    `json:"tag,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+	Rollback   *Rollback `json:"rollback,omitempty"`
+	// Conflicts are keys edited in consul that the commit was not applied to
+	Conflicts []string `json:"conflicts,omitempty"`
+	// Normalization the values were written with
+	Normalization *Normalization `json:"normalization,omitempty"`
+	// Rewrite is a rewritten history of the branch that is waiting for approval
+	Rewrite *Rewrite `json:"rewrite,omitempty"`
+	// ModifyIndex of the state key when it was read
+	ModifyIndex uint64 `json:"-"`
+}
+
+//Rewrite records that the head of a branch no longer descends from the applied commit
+type Rewrite struct {
+	// From is the applied commit
+	From string `json:"from"`
+	// To is the head of the rewritten branch
+	To string `json:"to"`
+	// Approved is set by an operator to let sync apply To
+	Approved bool `json:"approved"`
+}
+
+//Normalization records the policies file contents were normalized with
+type Normalization struct {
+	// Default policy of files no rule matches
+	Default string `json:"default"`
+	// Rules are glob=policy pairs, the last matching rule wins
+	Rules []string `json:"rules,omitempty"`
+}
+
+//Rollback records that consul was rolled back from an applied commit to an earlier one
+type Rollback struct {
+	// From is the commit that was applied before the rollback
+	From string `json:"from"`
+	// FromTag is the release tag that was applied before the rollback
+	FromTag string `json:"from_tag,omitempty"`
+	// To is the revision that was rolled back to
+	To string `json:"to"`
+}
+
+//ReadState reads the sync state stored at key, nil is returned when there is no state
+func (c *ConsulHandler) ReadState(key string) (*State, error) {
+	kvPair, _, err := c.Client.KV().Get(key, &api.QueryOptions{Token: c.opts.Config.Token})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed reading state")
+	}
+	if kvPair == nil {
+		return nil, nil
+	}
+	state := &State{}
+	if err := json.Unmarshal(kvPair.Value, state); err != nil {
+		return nil, errors.Wrapf(err, "failed decoding state at %s", key)
+	}
+	state.ModifyIndex = kvPair.ModifyIndex
+	return state, nil
+}
+
+//StateGuard returns a transaction operation that rolls the transaction back once the state read
+//from key has been replaced
+func StateGuard(key string, state *State) *api.KVTxnOp {
+	return &api.KVTxnOp{Verb: api.KVCheckIndex, Key: key, Index: state.ModifyIndex}
+}
+
+//StateOp returns a transaction operation that stores the state at key
+func StateOp(key string, state *State) (*api.KVTxnOp, error) {
+	value, err := json.Marshal(state)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed encoding state")
+	}
+	return &api.KVTxnOp{Verb: api.KVSet, Key: key, Value: value, Flags: WriteFlag}, nil
+}
+
+//StepsKey is where replayed commits are recorded relative to the consul path, one key per commit
+const StepsKey = ".git2consul/steps"
+
+//Step records how a replayed commit was applied to consul
+type Step struct {
+	Commit  string    `json:"commit"`
+	Parent  string    `json:"parent"`
+	Author  string    `json:"author"`
+	Message string    `json:"message"`
+	Applied time.Time `json:"applied"`
+	// Operations are the key writes and deletes the commit applied
+	Operations int      `json:"operations"`
+	Conflicts  []string `json:"conflicts,omitempty"`
+	// Error is why the commit could not be applied
+	Error string `json:"error,omitempty"`
+}
+
+//StepOp returns the operation that records a replayed commit at key
+func StepOp(key string, step *Step) (*api.KVTxnOp, error) {
+	value, err := json.Marshal(step)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed encoding step")
+	}
+	return &api.KVTxnOp{Verb: api.KVSet, Key: key, Value: value, Flags: WriteFlag}, nil
+}
+
 //ServiceRegistration registers a service by name
 func (c *ConsulHandler) ServiceRegistration(name string, tags ...string) error {
 	return c.Client.Agent().ServiceRegister(&api.AgentServiceRegistration{Name: name, Tags: tags})
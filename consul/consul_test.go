@@ -2,6 +2,8 @@ package consul
 
 import (
 	"testing"
+
+	"github.com/hashicorp/consul/api"
 )
 
 func TestNewHandler(t *testing.T) {
@@ -48,3 +50,86 @@ func TestIsExist(t *testing.T) {
 	}
 
 }
+
+func TestApplyTxn(t *testing.T) {
+	client, _ := NewHandler(Config("localhost:8500", ""))
+	ops := api.KVTxnOps{
+		&api.KVTxnOp{Verb: api.KVSet, Key: "git2consul/test/txn/a", Value: []byte("a")},
+		&api.KVTxnOp{Verb: api.KVSet, Key: "git2consul/test/txn/b", Value: []byte("b")},
+		&api.KVTxnOp{Verb: api.KVDelete, Key: "git2consul/test/txn/a"},
+	}
+	if err := client.ApplyTxn(ops, TxnSplit); err != nil {
+		t.Error(err)
+	}
+	data, err := client.read("git2consul/test/txn/b")
+	if string(data) != "b" || err != nil {
+		t.Fail()
+	}
+}
+
+func TestApplyTxnReject(t *testing.T) {
+	client, _ := NewHandler(Config("localhost:8500", ""))
+	var ops api.KVTxnOps
+	for i := 0; i <= MaxTxnOps; i++ {
+		ops = append(ops, &api.KVTxnOp{Verb: api.KVDelete, Key: "git2consul/test/txn/reject"})
+	}
+	if err := client.ApplyTxn(ops, TxnReject); err == nil {
+		t.Log("expected oversized transaction to be rejected")
+		t.Fail()
+	}
+}
+
+func TestApplyTxnGroupsTooLarge(t *testing.T) {
+	client, _ := NewHandler(Config("localhost:8500", ""))
+	var group api.KVTxnOps
+	for i := 0; i < MaxTxnOps; i++ {
+		group = append(group, &api.KVTxnOp{Verb: api.KVDelete, Key: "git2consul/test/txn/group"})
+	}
+	guard := &api.KVTxnOp{Verb: api.KVCheckSession, Key: "git2consul/test/txn/lock"}
+	if err := client.ApplyTxnGroups([]api.KVTxnOps{group}, TxnSplit, guard); err == nil {
+		t.Log("expected a group larger than a transaction to be rejected")
+		t.Fail()
+	}
+}
+
+func TestWatcherChanges(t *testing.T) {
+	own := &writeLog{writes: map[string]ownWrite{}, watched: true}
+	w := &Watcher{own: own, known: map[string]uint64{
+		"app/flagged":      1,
+		"app/own":          1,
+		"app/own-deleted":  1,
+		"app/foreign-gone": 1,
+		"app/untouched":    1,
+	}}
+	own.record(api.KVTxnOps{
+		&api.KVTxnOp{Verb: api.KVSet, Key: "app/own", Flags: WriteFlag},
+		&api.KVTxnOp{Verb: api.KVDelete, Key: "app/own-deleted"},
+	}, &api.KVTxnResponse{Results: []*api.KVPair{{Key: "app/own", ModifyIndex: 5}}})
+	writes := w.changes(api.KVPairs{
+		// an edit that keeps the flag git2consul writes
+		{Key: "app/flagged", ModifyIndex: 6, Flags: WriteFlag},
+		{Key: "app/own", ModifyIndex: 5, Flags: WriteFlag},
+		{Key: "app/untouched", ModifyIndex: 1, Flags: WriteFlag},
+		{Key: "app/new", ModifyIndex: 8},
+	})
+	foreign := map[string]bool{}
+	for _, write := range writes {
+		foreign[write.Key] = write.Deleted
+	}
+	expected := map[string]bool{
+		"app/flagged":      false,
+		"app/new":          false,
+		"app/foreign-gone": true,
+	}
+	if len(foreign) != len(expected) {
+		t.Errorf("expected %v to be foreign, got %v", expected, foreign)
+	}
+	for key, deleted := range expected {
+		if got, ok := foreign[key]; !ok || got != deleted {
+			t.Errorf("expected %s to be reported with deleted=%v, got %v", key, deleted, foreign)
+		}
+	}
+	if len(own.writes) != 0 {
+		t.Errorf("expected the matched writes to be forgotten, got %v", own.writes)
+	}
+}
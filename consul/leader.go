@@ -0,0 +1,137 @@
+package consul
+
+import (
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const leaderSessionTTL = "15s"
+
+//Leader holds a consul session lock so only one git2consul writes to consul. The session is kept
+//for the life of the process, followers retry the lock with it until it is invalidated
+type Leader struct {
+	client  *api.Client
+	key     string
+	session string
+	lock    *api.Lock
+	lostCh  <-chan struct{}
+	renewCh chan struct{}
+	// expired is closed once the session can no longer be renewed
+	expired chan struct{}
+}
+
+//NewLeader prepares a leader election on the lock key
+func (c *ConsulHandler) NewLeader(key string) *Leader {
+	return &Leader{client: c.Client, key: key}
+}
+
+//Acquire tries once to take the lock and reports whether this process is the leader
+func (l *Leader) Acquire() (bool, error) {
+	if l.IsLeader() {
+		return true, nil
+	}
+	if err := l.ensureSession(); err != nil {
+		return false, err
+	}
+	lock, err := l.client.LockOpts(&api.LockOptions{
+		Key:          l.key,
+		Session:      l.session,
+		LockTryOnce:  true,
+		LockWaitTime: time.Second,
+	})
+	if err != nil {
+		return false, errors.Wrapf(err, "failed acquiring lock %s", l.key)
+	}
+	lostCh, err := lock.Lock(nil)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed acquiring lock %s", l.key)
+	}
+	if lostCh == nil {
+		return false, nil
+	}
+	l.lock, l.lostCh = lock, lostCh
+	logrus.WithField("lock-key", l.key).Info("acquired leadership")
+	return true, nil
+}
+
+//ensureSession creates the leader session unless the current one is still renewed
+func (l *Leader) ensureSession() error {
+	if l.session != "" {
+		select {
+		case <-l.expired:
+			logrus.WithField("lock-key", l.key).Warning("leader session expired, creating a new one")
+			close(l.renewCh)
+			l.session, l.renewCh, l.expired = "", nil, nil
+		default:
+			return nil
+		}
+	}
+	session, _, err := l.client.Session().Create(&api.SessionEntry{
+		Name:     "git2consul",
+		TTL:      leaderSessionTTL,
+		Behavior: api.SessionBehaviorRelease,
+	}, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed creating leader session")
+	}
+	renewCh, expired := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(expired)
+		if err := l.client.Session().RenewPeriodic(leaderSessionTTL, session, nil, renewCh); err != nil {
+			logrus.WithError(err).WithField("lock-key", l.key).Debug("stopped renewing leader session")
+		}
+	}()
+	l.session, l.renewCh, l.expired = session, renewCh, expired
+	return nil
+}
+
+//IsLeader tells whether this process still holds the lock
+func (l *Leader) IsLeader() bool {
+	if l.lostCh == nil {
+		return false
+	}
+	select {
+	case <-l.lostCh:
+		// the session is kept, Acquire replaces it once it expired
+		logrus.WithField("lock-key", l.key).Warning("lost leadership")
+		l.lock, l.lostCh = nil, nil
+		return false
+	default:
+		return true
+	}
+}
+
+//Guard returns a transaction operation that rolls the transaction back unless this process holds the lock
+func (l *Leader) Guard() *api.KVTxnOp {
+	return &api.KVTxnOp{Verb: api.KVCheckSession, Key: l.key, Session: l.session}
+}
+
+//HolderGuard returns a transaction operation that rolls the transaction back unless the process
+//holding the lock key still holds it, nil when nobody holds it
+func (c *ConsulHandler) HolderGuard(key string) (*api.KVTxnOp, error) {
+	kvPair, _, err := c.Client.KV().Get(key, &api.QueryOptions{Token: c.opts.Config.Token})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed reading lock %s", key)
+	}
+	if kvPair == nil || kvPair.Session == "" {
+		return nil, nil
+	}
+	return &api.KVTxnOp{Verb: api.KVCheckSession, Key: key, Session: kvPair.Session}, nil
+}
+
+//Release gives up the lock and its session
+func (l *Leader) Release() {
+	if l.lock != nil {
+		if err := l.lock.Unlock(); err != nil && err != api.ErrLockNotHeld {
+			logrus.WithError(err).WithField("lock-key", l.key).Debug("failed releasing lock")
+		}
+	}
+	if l.renewCh != nil {
+		close(l.renewCh)
+		l.client.Session().Destroy(l.session, nil)
+	}
+	l.session, l.lock, l.lostCh, l.renewCh, l.expired = "", nil, nil, nil, nil
+}
@@ -0,0 +1,157 @@
+package consul
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/pkg/errors"
+)
+
+//WriteFlag is set on every key git2consul writes to mark it for other tooling, the watcher does not
+//rely on it since a foreign edit can keep the flag
+const WriteFlag uint64 = 0x67697432636f6e73
+
+//watchWaitTime bounds a single blocking query
+const watchWaitTime = 5 * time.Minute
+
+//Write is a change to a key that git2consul did not make
+type Write struct {
+	Key string
+	// Deleted is set when the key was removed
+	Deleted bool
+	// ModifyIndex of the write, zero for deletes
+	ModifyIndex uint64
+}
+
+//ownWrite is the last change git2consul made to a key
+type ownWrite struct {
+	index   uint64
+	deleted bool
+}
+
+//writeLog remembers the changes of the transactions git2consul applied until a watcher sees them
+type writeLog struct {
+	sync.Mutex
+	writes map[string]ownWrite
+	// watched is set once a watcher runs, nothing is remembered before
+	watched bool
+}
+
+//ownWrites is shared by every handler of the process so a watcher knows the writes of the syncs next to it
+var ownWrites = &writeLog{writes: map[string]ownWrite{}}
+
+//record remembers the keys a committed transaction deleted and the ModifyIndex of the keys it wrote
+func (l *writeLog) record(ops api.KVTxnOps, resp *api.KVTxnResponse) {
+	l.Lock()
+	defer l.Unlock()
+	if !l.watched {
+		return
+	}
+	for _, op := range ops {
+		if op.Verb == api.KVDelete || op.Verb == api.KVDeleteCAS {
+			l.writes[op.Key] = ownWrite{deleted: true}
+		}
+	}
+	if resp == nil {
+		return
+	}
+	for _, kvPair := range resp.Results {
+		if kvPair != nil {
+			l.writes[kvPair.Key] = ownWrite{index: kvPair.ModifyIndex}
+		}
+	}
+}
+
+//owns tells whether git2consul made the change of a key, a deleted key is passed with a zero index.
+//A change is forgotten once it is matched since a watcher sees every change only once
+func (l *writeLog) owns(key string, index uint64, deleted bool) bool {
+	l.Lock()
+	defer l.Unlock()
+	write, ok := l.writes[key]
+	if !ok {
+		return false
+	}
+	if write.deleted && !deleted {
+		// the key was written again by someone else after git2consul deleted it
+		delete(l.writes, key)
+		return false
+	}
+	if write.deleted != deleted || write.index != index {
+		return false
+	}
+	delete(l.writes, key)
+	return true
+}
+
+//watch starts remembering the changes of applied transactions
+func (l *writeLog) watch() {
+	l.Lock()
+	defer l.Unlock()
+	l.watched = true
+}
+
+//Watcher follows a prefix with blocking queries
+type Watcher struct {
+	handler *ConsulHandler
+	prefix  string
+	index   uint64
+	known   map[string]uint64
+	own     *writeLog
+}
+
+//NewWatcher prepares a watch of every key under prefix
+func (c *ConsulHandler) NewWatcher(prefix string) *Watcher {
+	ownWrites.watch()
+	return &Watcher{handler: c, prefix: prefix, own: ownWrites}
+}
+
+//Next blocks until a key under the prefix changes and returns the changes git2consul did not make
+//itself, any ModifyIndex other than the one its own transaction returned is foreign. A write seen
+//before its transaction returned is reported too, the drift check that follows finds nothing to do.
+//The first call only records the current keys
+func (w *Watcher) Next() ([]*Write, error) {
+	kvPairs, meta, err := w.handler.Client.KV().List(w.prefix, &api.QueryOptions{
+		Token:     w.handler.opts.Config.Token,
+		WaitIndex: w.index,
+		WaitTime:  watchWaitTime,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed watching %s", w.prefix)
+	}
+	if meta.LastIndex < w.index {
+		// the index went backwards such as after a snapshot restore, start over
+		w.index, w.known = 0, nil
+		return nil, nil
+	}
+	w.index = meta.LastIndex
+	return w.changes(kvPairs), nil
+}
+
+//changes compares the keys under the prefix with the ones seen last and returns the foreign changes
+func (w *Watcher) changes(kvPairs api.KVPairs) []*Write {
+	current := make(map[string]uint64, len(kvPairs))
+	var writes []*Write
+	for _, kvPair := range kvPairs {
+		current[kvPair.Key] = kvPair.ModifyIndex
+		if w.known == nil || w.known[kvPair.Key] == kvPair.ModifyIndex {
+			continue
+		}
+		if !w.own.owns(kvPair.Key, kvPair.ModifyIndex, false) {
+			writes = append(writes, &Write{Key: kvPair.Key, ModifyIndex: kvPair.ModifyIndex})
+		}
+	}
+	for key := range w.known {
+		if _, ok := current[key]; !ok && !w.own.owns(key, 0, true) {
+			writes = append(writes, &Write{Key: key, Deleted: true})
+		}
+	}
+	w.known = current
+	return writes
+}
+
+//FireEvent fires a consul user event
+func (c *ConsulHandler) FireEvent(name string, payload []byte) error {
+	_, _, err := c.Client.Event().Fire(&api.UserEvent{Name: name, Payload: payload}, &api.WriteOptions{Token: c.opts.Config.Token})
+	return errors.Wrapf(err, "failed firing event %s", name)
+}
@@ -0,0 +1,114 @@
+package expand
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+//Encoder compacts keys relative to a file into the contents of the file, it is the reverse of a Func
+type Encoder func(keys map[string][]byte) ([]byte, error)
+
+var encoders = map[string]Encoder{
+	".json": EncodeJSON,
+	".yaml": EncodeYAML,
+	".yml":  EncodeYAML,
+}
+
+//EncoderFor returns the encoder registered for a file extension such as .yaml
+func EncoderFor(ext string) (Encoder, bool) {
+	fn, ok := encoders[strings.ToLower(ext)]
+	return fn, ok
+}
+
+//EncodeJSON compacts keys into a json document
+func EncodeJSON(keys map[string][]byte) ([]byte, error) {
+	doc, err := Unflatten(keys)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return nil, errors.Wrap(err, "failed encoding json")
+	}
+	return buf.Bytes(), nil
+}
+
+//EncodeYAML compacts keys into a yaml document
+func EncodeYAML(keys map[string][]byte) ([]byte, error) {
+	doc, err := Unflatten(keys)
+	if err != nil {
+		return nil, err
+	}
+	data, err := yaml.Marshal(doc)
+	return data, errors.Wrap(err, "failed encoding yaml")
+}
+
+//Unflatten builds the document keys were expanded from. Keys are split on / into nested objects,
+//objects whose keys are 0 to n-1 become arrays and every value is kept as a string
+func Unflatten(keys map[string][]byte) (interface{}, error) {
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	root := map[string]interface{}{}
+	for _, key := range sorted {
+		segments := strings.Split(key, "/")
+		parent := root
+		for i, segment := range segments {
+			if segment == "" {
+				return nil, errors.Errorf("key %q has an empty segment", key)
+			}
+			if i == len(segments)-1 {
+				if _, ok := parent[segment]; ok {
+					return nil, errors.Errorf("key %q is both a value and a folder", key)
+				}
+				parent[segment] = string(keys[key])
+				continue
+			}
+			child, ok := parent[segment]
+			if !ok {
+				child = map[string]interface{}{}
+				parent[segment] = child
+			}
+			folder, ok := child.(map[string]interface{})
+			if !ok {
+				return nil, errors.Errorf("key %q is both a value and a folder", strings.Join(segments[:i+1], "/"))
+			}
+			parent = folder
+		}
+	}
+	return arrays(root), nil
+}
+
+//arrays turns objects keyed by 0 to n-1 into arrays
+func arrays(value interface{}) interface{} {
+	folder, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	for key, child := range folder {
+		folder[key] = arrays(child)
+	}
+	list := make([]interface{}, len(folder))
+	for key, child := range folder {
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(list) || strconv.Itoa(i) != key {
+			return folder
+		}
+		list[i] = child
+	}
+	if len(list) == 0 {
+		return folder
+	}
+	return list
+}
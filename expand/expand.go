@@ -0,0 +1,196 @@
+package expand
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v2"
+)
+
+//Func expands the contents of a file into keys relative to the file
+type Func func(data []byte) (map[string][]byte, error)
+
+var expanders = map[string]Func{
+	".json":       JSON,
+	".yaml":       YAML,
+	".yml":        YAML,
+	".toml":       TOML,
+	".properties": Properties,
+}
+
+//Register adds or replaces the expander used for a file extension
+func Register(ext string, fn Func) {
+	expanders[strings.ToLower(ext)] = fn
+}
+
+//ForFile returns the expander registered for the extension of path
+func ForFile(path string) (Func, bool) {
+	fn, ok := expanders[strings.ToLower(filepath.Ext(path))]
+	return fn, ok
+}
+
+//Extensions lists the file extensions that have a registered expander
+func Extensions() []string {
+	exts := make([]string, 0, len(expanders))
+	for ext := range expanders {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+//JSON expands a json document
+func JSON(data []byte) (map[string][]byte, error) {
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, errors.Wrap(err, "failed decoding json")
+	}
+	return flatten(doc)
+}
+
+//YAML expands a yaml document
+func YAML(data []byte) (map[string][]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, errors.Wrap(err, "failed decoding yaml")
+	}
+	return flatten(doc)
+}
+
+//TOML expands a toml document
+func TOML(data []byte) (map[string][]byte, error) {
+	doc := map[string]interface{}{}
+	if _, err := toml.Decode(string(data), &doc); err != nil {
+		return nil, errors.Wrap(err, "failed decoding toml")
+	}
+	return flatten(doc)
+}
+
+//Properties expands a java style properties file
+func Properties(data []byte) (map[string][]byte, error) {
+	keys := map[string][]byte{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	var line string
+	for scanner.Scan() {
+		text := strings.TrimLeft(scanner.Text(), " \t\f")
+		if line == "" && (text == "" || text[0] == '#' || text[0] == '!') {
+			continue
+		}
+		if strings.HasSuffix(text, `\`) && !strings.HasSuffix(text, `\\`) {
+			line += strings.TrimSuffix(text, `\`)
+			continue
+		}
+		line += text
+		key, value := splitProperty(line)
+		keys[key] = []byte(value)
+		line = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed reading properties")
+	}
+	if line != "" {
+		key, value := splitProperty(line)
+		keys[key] = []byte(value)
+	}
+	return keys, nil
+}
+
+func splitProperty(line string) (string, string) {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '=', ':', ' ', '\t':
+			value := strings.TrimLeft(line[i:], " \t")
+			if value != "" && (value[0] == '=' || value[0] == ':') {
+				value = strings.TrimLeft(value[1:], " \t")
+			}
+			return unescapeProperty(line[:i]), unescapeProperty(value)
+		}
+	}
+	return unescapeProperty(line), ""
+}
+
+func unescapeProperty(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+func flatten(doc interface{}) (map[string][]byte, error) {
+	keys := map[string][]byte{}
+	switch doc.(type) {
+	case map[string]interface{}, map[interface{}]interface{}, []interface{}, []map[string]interface{}:
+		flattenValue("", doc, keys)
+		return keys, nil
+	case nil:
+		return keys, nil
+	}
+	return nil, errors.New("document does not contain any keys")
+}
+
+func flattenValue(prefix string, value interface{}, keys map[string][]byte) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			flattenValue(join(prefix, key), child, keys)
+		}
+	case map[interface{}]interface{}:
+		for key, child := range v {
+			flattenValue(join(prefix, fmt.Sprint(key)), child, keys)
+		}
+	case []interface{}:
+		for i, child := range v {
+			flattenValue(join(prefix, strconv.Itoa(i)), child, keys)
+		}
+	case []map[string]interface{}:
+		for i, child := range v {
+			flattenValue(join(prefix, strconv.Itoa(i)), child, keys)
+		}
+	case nil:
+		keys[prefix] = []byte{}
+	case string:
+		keys[prefix] = []byte(v)
+	case time.Time:
+		keys[prefix] = []byte(v.Format(time.RFC3339Nano))
+	default:
+		keys[prefix] = []byte(fmt.Sprint(v))
+	}
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "/" + key
+}
@@ -0,0 +1,111 @@
+package expand
+
+import (
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	keys, err := JSON([]byte(`{"db": {"host": "localhost", "port": 5432, "replicas": ["a", "b"]}, "debug": null}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"db/host":       "localhost",
+		"db/port":       "5432",
+		"db/replicas/0": "a",
+		"db/replicas/1": "b",
+		"debug":         "",
+	}
+	checkKeys(t, expected, keys)
+}
+
+func TestYAML(t *testing.T) {
+	keys, err := YAML([]byte("db:\n  host: localhost\n  port: 5432\nenabled: true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkKeys(t, map[string]string{"db/host": "localhost", "db/port": "5432", "enabled": "true"}, keys)
+}
+
+func TestTOML(t *testing.T) {
+	keys, err := TOML([]byte("title = \"app\"\n[db]\nhost = \"localhost\"\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkKeys(t, map[string]string{"title": "app", "db/host": "localhost"}, keys)
+}
+
+func TestProperties(t *testing.T) {
+	keys, err := Properties([]byte("# comment\ndb.host=localhost\ndb.port : 5432\nname value\nlong = one \\\n    two\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkKeys(t, map[string]string{"db.host": "localhost", "db.port": "5432", "name": "value", "long": "one two"}, keys)
+}
+
+func TestScalarDocument(t *testing.T) {
+	if _, err := YAML([]byte("just a string")); err == nil {
+		t.Log("expected an error expanding a scalar document")
+		t.Fail()
+	}
+}
+
+func TestForFile(t *testing.T) {
+	if _, ok := ForFile("config/app.YAML"); !ok {
+		t.Log("did not find yaml expander")
+		t.Fail()
+	}
+	if _, ok := ForFile("README.md"); ok {
+		t.Log("found an expander for markdown")
+		t.Fail()
+	}
+}
+
+func checkKeys(t *testing.T, expected map[string]string, keys map[string][]byte) {
+	t.Helper()
+	if len(expected) != len(keys) {
+		t.Errorf("expected %d keys got %d: %v", len(expected), len(keys), keys)
+	}
+	for key, value := range expected {
+		if string(keys[key]) != value {
+			t.Errorf("key %s expected %q got %q", key, value, keys[key])
+		}
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	keys := map[string][]byte{
+		"db/host":       []byte("localhost"),
+		"db/port":       []byte("5432"),
+		"db/replicas/0": []byte("a"),
+		"db/replicas/1": []byte("b"),
+		"enabled":       []byte("true"),
+		"url":           []byte("http://a/?b=1&c=<d>"),
+	}
+	codecs := []struct {
+		name   string
+		encode Encoder
+		expand Func
+	}{{"json", EncodeJSON, JSON}, {"yaml", EncodeYAML, YAML}}
+	expected := map[string]string{}
+	for key, value := range keys {
+		expected[key] = string(value)
+	}
+	for _, codec := range codecs {
+		data, err := codec.encode(keys)
+		if err != nil {
+			t.Fatalf("%s: %v", codec.name, err)
+		}
+		expanded, err := codec.expand(data)
+		if err != nil {
+			t.Fatalf("%s: %v", codec.name, err)
+		}
+		checkKeys(t, expected, expanded)
+	}
+}
+
+func TestUnflattenConflict(t *testing.T) {
+	if _, err := Unflatten(map[string][]byte{"db": []byte("x"), "db/host": []byte("y")}); err == nil {
+		t.Error("expected a key that is both a value and a folder to fail")
+	}
+}
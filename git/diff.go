@@ -2,6 +2,7 @@ package git
 
 import (
 	git2go "github.com/libgit2/git2go/v29"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -12,6 +13,28 @@ type DiffDelta struct {
 	OldFile string
 	// type of delta
 	Status string
+	// NewID blob id of the new file
+	NewID string
+	// OldID blob id of the old file
+	OldID string
+	// NewMode file mode of the new file
+	NewMode uint16
+	// OldMode file mode of the old file
+	OldMode uint16
+}
+
+//NewIsFile tells whether the new side of the delta is a regular file rather than a symlink or submodule
+func (d *DiffDelta) NewIsFile() bool {
+	return isFileMode(d.NewMode)
+}
+
+//OldIsFile tells whether the old side of the delta is a regular file rather than a symlink or submodule
+func (d *DiffDelta) OldIsFile() bool {
+	return isFileMode(d.OldMode)
+}
+
+func isFileMode(mode uint16) bool {
+	return git2go.Filemode(mode) == git2go.FilemodeBlob || git2go.Filemode(mode) == git2go.FilemodeBlobExecutable
 }
 
 func (c *Collection) DifftoHead(oid string) []*DiffDelta {
@@ -25,6 +48,10 @@ func (c *Collection) DifftoHead(oid string) []*DiffDelta {
 }
 
 func diffs(r *git2go.Repository, commit1, commit2 *git2go.Commit) []*DiffDelta {
+	if commit1 == nil || commit2 == nil {
+		logrus.Error("cannot diff a commit that does not exist")
+		return nil
+	}
 	tree1, err := commit1.Tree()
 	if err != nil {
 		logrus.WithError(err).Error("failed getting tree for commit")
@@ -36,18 +63,84 @@ func diffs(r *git2go.Repository, commit1, commit2 *git2go.Commit) []*DiffDelta {
 		logrus.WithError(err).Error("failed getting tree for commit")
 		return nil
 	}
+	return diffTrees(r, tree1, tree2)
+}
+
+//Diff returns the deltas between two revisions, an empty from revision diffs against an empty tree
+func (c *Collection) Diff(from, to string) ([]*DiffDelta, error) {
+	var fromTree *git2go.Tree
+	if from != "" {
+		tree, err := c.revisionTree(from)
+		if err != nil {
+			return nil, err
+		}
+		fromTree = tree
+	}
+	toTree, err := c.revisionTree(to)
+	if err != nil {
+		return nil, err
+	}
+	return diffTrees(c.Repository, fromTree, toTree), nil
+}
+
+//ResolveCommit returns the commit id a revision such as a sha, tag or HEAD~1 points to
+func (c *Collection) ResolveCommit(revision string) (string, error) {
+	commit, err := c.revisionCommit(revision)
+	if err != nil {
+		return "", err
+	}
+	defer commit.Free()
+	return commit.Id().String(), nil
+}
+
+func (c *Collection) revisionCommit(revision string) (*git2go.Commit, error) {
+	object, err := c.Repository.RevparseSingle(revision)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed resolving revision %s", revision)
+	}
+	defer object.Free()
+	commit, err := object.Peel(git2go.ObjectCommit)
+	if err != nil {
+		return nil, errors.Wrapf(err, "revision %s is not a commit", revision)
+	}
+	return commit.AsCommit()
+}
 
+func (c *Collection) revisionTree(revision string) (*git2go.Tree, error) {
+	commit, err := c.revisionCommit(revision)
+	if err != nil {
+		return nil, err
+	}
+	defer commit.Free()
+	return commit.Tree()
+}
+
+func diffTrees(r *git2go.Repository, tree1, tree2 *git2go.Tree) []*DiffDelta {
 	diffOptions, err := git2go.DefaultDiffOptions()
 	if err != nil {
 		logrus.WithError(err).Error("failed getting diff options")
 		return nil
 	}
+	// without this a file turned into a symlink shows up as modified
+	diffOptions.Flags |= git2go.DiffIncludeTypeChange
 
 	diff, err := r.DiffTreeToTree(tree1, tree2, &diffOptions)
 	if err != nil {
 		logrus.WithError(err).Error("failed to diff from tree to tree")
 		return nil
 	}
+	defer diff.Free()
+
+	findOptions, err := git2go.DefaultDiffFindOptions()
+	if err != nil {
+		logrus.WithError(err).Error("failed getting diff find options")
+		return nil
+	}
+	findOptions.Flags |= git2go.DiffFindRenames | git2go.DiffFindCopies
+	if err := diff.FindSimilar(&findOptions); err != nil {
+		logrus.WithError(err).Error("failed finding renames and copies")
+		return nil
+	}
 
 	numOfDeltas, err := diff.NumDeltas()
 	if err != nil {
@@ -63,17 +156,59 @@ func diffs(r *git2go.Repository, commit1, commit2 *git2go.Commit) []*DiffDelta {
 		diffDelta, err := diff.GetDelta(delta)
 		if err != nil {
 			logrus.WithError(err).WithField("delta", delta).Warningln("did not get diff")
+			continue
 		}
 		diffDeltas = append(diffDeltas, &DiffDelta{
 			NewFile: diffDelta.NewFile.Path,
 			OldFile: diffDelta.OldFile.Path,
 			Status:  diffDelta.Status.String(),
+			NewID:   diffDelta.NewFile.Oid.String(),
+			OldID:   diffDelta.OldFile.Oid.String(),
+			NewMode: diffDelta.NewFile.Mode,
+			OldMode: diffDelta.OldFile.Mode,
 		})
 	}
 
 	return diffDeltas
 }
 
+//IsReachable tells whether a commit exists and is the head or one of its ancestors
+func (c *Collection) IsReachable(commitSha string) bool {
+	oid, err := git2go.NewOid(commitSha)
+	if err != nil {
+		return false
+	}
+	ref, err := c.Head()
+	if err != nil {
+		logrus.WithError(err).Error("failed to get head")
+		return false
+	}
+	defer ref.Free()
+	if ref.Target().Equal(oid) {
+		return true
+	}
+	ok, err := c.Repository.DescendantOf(ref.Target(), oid)
+	if err != nil {
+		logrus.WithError(err).WithField("commit", commitSha).Warning("failed checking commit ancestry")
+		return false
+	}
+	return ok
+}
+
+//HasCommit tells whether a commit is in the object database, reachable from a branch or not
+func (c *Collection) HasCommit(commitSha string) bool {
+	oid, err := git2go.NewOid(commitSha)
+	if err != nil {
+		return false
+	}
+	commit, err := c.Repository.LookupCommit(oid)
+	if err != nil {
+		return false
+	}
+	commit.Free()
+	return true
+}
+
 func (c *Collection) getCommit(commitSha string) *git2go.Commit {
 	oid, err := git2go.NewOid(commitSha)
 	if err != nil {
@@ -88,3 +223,44 @@ func (c *Collection) getCommit(commitSha string) *git2go.Commit {
 	}
 	return commit
 }
+
+//ReadBlob reads the contents of a blob by id, a zero id returns no content
+func (c *Collection) ReadBlob(id string) []byte {
+	oid, err := git2go.NewOid(id)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("failed getting blob oid")
+		return nil
+	}
+	if oid.IsZero() {
+		return nil
+	}
+	blob, err := c.Repository.LookupBlob(oid)
+	if err != nil {
+		logrus.WithError(err).WithField("id", id).Error("failed looking up blob")
+		return nil
+	}
+	defer blob.Free()
+	return blob.Contents()
+}
+
+//ReadFileAt returns the contents of a file at a revision, nil is returned when the file does not exist
+func (c *Collection) ReadFileAt(revision, path string) ([]byte, error) {
+	tree, err := c.revisionTree(revision)
+	if err != nil {
+		return nil, err
+	}
+	defer tree.Free()
+	entry, err := tree.EntryByPath(path)
+	if git2go.IsErrorCode(err, git2go.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed looking up %s", path)
+	}
+	blob, err := c.Repository.LookupBlob(entry.Id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed reading %s", path)
+	}
+	defer blob.Free()
+	return blob.Contents(), nil
+}
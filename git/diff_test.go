@@ -0,0 +1,36 @@
+package git
+
+import (
+	"testing"
+
+	git2go "github.com/libgit2/git2go/v29"
+)
+
+func TestDiffFileBecomesSymlink(t *testing.T) {
+	c, cleanup := initTestRepo(t)
+	defer cleanup()
+	first := testCommit(t, c, "file", map[string]testEntry{
+		"config": {"value", git2go.FilemodeBlob},
+	})
+	second := testCommit(t, c, "symlink", map[string]testEntry{
+		"config": {"target", git2go.FilemodeLink},
+	}, first)
+
+	diffs, err := c.Diff(first.String(), second.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 {
+		t.Fatalf("expected one delta, got %d", len(diffs))
+	}
+	diff := diffs[0]
+	if diff.Status != "TypeChange" {
+		t.Errorf("expected a TypeChange delta, got %s", diff.Status)
+	}
+	if !diff.OldIsFile() {
+		t.Error("expected the old side to be a file")
+	}
+	if diff.NewIsFile() {
+		t.Error("expected the new side to be a symlink")
+	}
+}
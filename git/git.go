@@ -4,9 +4,13 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	git2go "github.com/libgit2/git2go/v29"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -16,6 +20,13 @@ func (c *Collection) Pull(opts *git2go.CloneOptions, remoteName, branch string)
 		logrus.WithField("branch", remoteName).Warning("unable to find path of the local repository of branch to clone")
 		return nil
 	}
+	if c.Repository.IsBare() {
+		// without a working tree there is nothing to check out or merge
+		if _, err := c.Fetch(opts, remoteName, branch); err != nil {
+			logrus.WithError(err).Error("failed fetching remote repository")
+		}
+		return c
+	}
 	remote, err := c.Repository.Remotes.Lookup(remoteName)
 	if err != nil {
 		logrus.WithError(err).Error("failed looking up remote repository")
@@ -90,6 +101,74 @@ func (c *Collection) Pull(opts *git2go.CloneOptions, remoteName, branch string)
 	return c
 }
 
+//FetchResult is how a fetch moved a branch
+type FetchResult struct {
+	// Old commit of the branch, empty when the branch was not fetched before
+	Old string
+	// New commit of the branch
+	New string
+	// Forced is set when New does not descend from Old because the history of the branch was rewritten
+	Forced bool
+}
+
+//Fetch updates a branch from a remote without touching a working tree. The local branch is fast-forwarded,
+//or reset when the remote branch was force pushed, and becomes the head
+func (c *Collection) Fetch(opts *git2go.CloneOptions, remoteName, branch string) (*FetchResult, error) {
+	remote, err := c.Repository.Remotes.Lookup(remoteName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed looking up remote repository")
+	}
+	defer remote.Free()
+	trackingRef := fmt.Sprintf("refs/remotes/%s/%s", remoteName, branch)
+	if err := remote.Fetch([]string{fmt.Sprintf("+refs/heads/%s:%s", branch, trackingRef)}, opts.FetchOptions, ""); err != nil {
+		return nil, errors.Wrap(err, "failed fetching remote repository")
+	}
+	tracking, err := c.Repository.References.Lookup(trackingRef)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed looking up %s", trackingRef)
+	}
+	defer tracking.Free()
+	result := &FetchResult{New: tracking.Target().String()}
+	localRef := fmt.Sprintf("refs/heads/%s", branch)
+	local, err := c.Repository.References.Lookup(localRef)
+	switch {
+	case err == nil:
+		defer local.Free()
+		result.Old = local.Target().String()
+		if !local.Target().Equal(tracking.Target()) {
+			descends, err := c.Repository.DescendantOf(tracking.Target(), local.Target())
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed checking whether %s descends from %s", result.New, result.Old)
+			}
+			result.Forced = !descends
+		}
+	case !git2go.IsErrorCode(err, git2go.ErrNotFound):
+		return nil, errors.Wrapf(err, "failed looking up %s", localRef)
+	}
+	message := "fetch: fast-forward"
+	if result.Forced {
+		message = "fetch: forced-update"
+	}
+	updated, err := c.Repository.References.Create(localRef, tracking.Target(), true, message)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed updating %s", localRef)
+	}
+	updated.Free()
+	if err := c.Repository.SetHead(localRef); err != nil {
+		return nil, errors.Wrap(err, "failed to set head of local branch")
+	}
+	return result, nil
+}
+
+//BranchRef returns the reference a branch is read from without checking it out, the remote tracking
+//branch of a clone or the local branch of a bare mirror
+func (c *Collection) BranchRef(remoteName, branch string) string {
+	if c.Repository.IsBare() {
+		return fmt.Sprintf("refs/heads/%s", branch)
+	}
+	return fmt.Sprintf("refs/remotes/%s/%s", remoteName, branch)
+}
+
 //Open repository
 func Open(repoPath string) *Collection {
 	repo, err := git2go.OpenRepository(repoPath)
@@ -117,7 +196,9 @@ func NewRepository(opt ...GitOptions) *Collection {
 			cloneOpts := CloneOptions(opts.username, opts.password, opts.publicKeyPath, opts.privateKeyPath, opts.passphrase, opts.fingerPrint)
 			if cloneOpts == nil {
 				logrus.Warningln("clone options do not exist")
+				cloneOpts = &git2go.CloneOptions{}
 			}
+			cloneOpts.Bare = opts.bare
 			repository, err := git2go.Clone(opts.url, opts.pullDirectory, cloneOpts)
 			if err != nil {
 				logrus.WithError(err).Error("failed to clone repo")
@@ -139,6 +220,7 @@ func NewRepository(opt ...GitOptions) *Collection {
 //WithIgnoredFiles type to make an optional parameter
 type WithIgnoredFiles map[string][]byte
 
+//ReadFile reads a file of the working tree, ReadBlob and ReadFileAt read a commit instead
 func (c *Collection) ReadFile(gitDir, filePath string) []byte {
 	data, err := ioutil.ReadFile(filepath.Join(gitDir, filePath))
 	if err != nil {
@@ -197,3 +279,203 @@ func CloneOptions(username, password, publickeyPath, privateKeyPath, passphrase
 	cloneOptions.FetchOptions.RemoteCallbacks = cbs
 	return cloneOptions
 }
+
+//RemoteBranches fetches every branch of a remote and returns the names of those matching a glob such as env/*
+func (c *Collection) RemoteBranches(opts *git2go.CloneOptions, remoteName, pattern string) ([]string, error) {
+	remote, err := c.Repository.Remotes.Lookup(remoteName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed looking up remote repository")
+	}
+	if err = remote.Fetch([]string{"refs/heads/*:refs/remotes/" + remoteName + "/*"}, opts.FetchOptions, ""); err != nil {
+		return nil, errors.Wrap(err, "failed fetching remote repository")
+	}
+	iter, err := c.Repository.NewBranchIterator(git2go.BranchRemote)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed listing remote branches")
+	}
+	defer iter.Free()
+	var names []string
+	err = iter.ForEach(func(b *git2go.Branch, _ git2go.BranchType) error {
+		name, err := b.Name()
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(name, remoteName+"/") {
+			return nil
+		}
+		name = strings.TrimPrefix(name, remoteName+"/")
+		if name == "HEAD" {
+			return nil
+		}
+		if ok, err := path.Match(pattern, name); err != nil || !ok {
+			return err
+		}
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed matching branches against %s", pattern)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+//CheckedOut tells whether a branch is the checked out head, a pull of a missing branch leaves the previous one checked out
+func (c *Collection) CheckedOut(branch string) bool {
+	if !ByBranch(branch)(c) {
+		return false
+	}
+	head, err := c.Repository.Head()
+	if err != nil {
+		logrus.WithError(err).Error("failed to get repo's head")
+		return false
+	}
+	defer head.Free()
+	return head.Name() == c.Ref.Name()
+}
+
+//Tags fetches the tags of a remote and returns those matching a glob such as config-v*
+func (c *Collection) Tags(opts *git2go.CloneOptions, remoteName, pattern string) ([]string, error) {
+	remote, err := c.Repository.Remotes.Lookup(remoteName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed looking up remote repository")
+	}
+	if err = remote.Fetch([]string{"+refs/tags/*:refs/tags/*"}, opts.FetchOptions, ""); err != nil {
+		return nil, errors.Wrap(err, "failed fetching tags")
+	}
+	tags, err := c.Repository.Tags.ListWithMatch(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed listing tags matching %s", pattern)
+	}
+	return tags, nil
+}
+
+//ErrNoChanges is returned by Commit when the staged tree matches the head commit
+var ErrNoChanges = errors.New("no changes to commit")
+
+//Commit stages paths of the working tree and commits them on the checked out branch, the new commit id is returned
+func (c *Collection) Commit(paths []string, message string, author *git2go.Signature) (string, error) {
+	index, err := c.Repository.Index()
+	if err != nil {
+		return "", errors.Wrap(err, "failed opening index")
+	}
+	defer index.Free()
+	for _, path := range paths {
+		if err := index.AddByPath(path); err != nil {
+			return "", errors.Wrapf(err, "failed staging %s", path)
+		}
+	}
+	if err := index.Write(); err != nil {
+		return "", errors.Wrap(err, "failed writing index")
+	}
+	treeID, err := index.WriteTree()
+	if err != nil {
+		return "", errors.Wrap(err, "failed writing tree")
+	}
+	tree, err := c.Repository.LookupTree(treeID)
+	if err != nil {
+		return "", errors.Wrap(err, "failed looking up tree")
+	}
+	defer tree.Free()
+	var parents []*git2go.Commit
+	// an unborn head has no parent, the commit creates the branch
+	if head, err := c.Repository.Head(); err == nil {
+		defer head.Free()
+		parent, err := c.Repository.LookupCommit(head.Target())
+		if err != nil {
+			return "", errors.Wrap(err, "failed looking up head commit")
+		}
+		defer parent.Free()
+		if parent.TreeId().Equal(treeID) {
+			return "", ErrNoChanges
+		}
+		parents = append(parents, parent)
+	}
+	oid, err := c.Repository.CreateCommit("HEAD", author, author, message, tree, parents...)
+	if err != nil {
+		return "", errors.Wrap(err, "failed creating commit")
+	}
+	return oid.String(), nil
+}
+
+//Push pushes a local branch to the branch of the same name on a remote, force allows the remote branch to be rewritten
+func (c *Collection) Push(opts *git2go.CloneOptions, remoteName, branch string, force bool) error {
+	remote, err := c.Repository.Remotes.Lookup(remoteName)
+	if err != nil {
+		return errors.Wrap(err, "failed looking up remote repository")
+	}
+	ref := "refs/heads/" + branch
+	refspec := ref + ":" + ref
+	if force {
+		refspec = "+" + refspec
+	}
+	err = remote.Push([]string{refspec}, &git2go.PushOptions{RemoteCallbacks: opts.FetchOptions.RemoteCallbacks})
+	return errors.Wrapf(err, "failed pushing %s", branch)
+}
+
+//CommitFiles commits writes and deletes on top of a parent commit to a branch without touching the working tree.
+//The branch is moved to the new commit even when it pointed elsewhere, ErrNoChanges is returned when the
+//branch already has the resulting tree on top of parent or the tree matches parent
+func (c *Collection) CommitFiles(branch, parent string, writes map[string][]byte, deletes []string, message string, author *git2go.Signature) (string, error) {
+	parentCommit, err := c.revisionCommit(parent)
+	if err != nil {
+		return "", err
+	}
+	defer parentCommit.Free()
+	parentTree, err := parentCommit.Tree()
+	if err != nil {
+		return "", errors.Wrap(err, "failed getting tree for commit")
+	}
+	defer parentTree.Free()
+	index, err := git2go.NewIndex()
+	if err != nil {
+		return "", errors.Wrap(err, "failed creating index")
+	}
+	defer index.Free()
+	if err := index.ReadTree(parentTree); err != nil {
+		return "", errors.Wrap(err, "failed reading tree into index")
+	}
+	for path, contents := range writes {
+		blob, err := c.Repository.CreateBlobFromBuffer(contents)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed writing blob for %s", path)
+		}
+		if err := index.Add(&git2go.IndexEntry{Path: path, Mode: git2go.FilemodeBlob, Id: blob}); err != nil {
+			return "", errors.Wrapf(err, "failed staging %s", path)
+		}
+	}
+	for _, path := range deletes {
+		if err := index.RemoveByPath(path); err != nil {
+			return "", errors.Wrapf(err, "failed removing %s", path)
+		}
+	}
+	treeID, err := index.WriteTreeTo(c.Repository)
+	if err != nil {
+		return "", errors.Wrap(err, "failed writing tree")
+	}
+	if treeID.Equal(parentTree.Id()) {
+		return "", ErrNoChanges
+	}
+	ref := "refs/heads/" + branch
+	if tip, err := c.revisionCommit(ref); err == nil {
+		defer tip.Free()
+		if tip.TreeId().Equal(treeID) && tip.ParentCount() == 1 && tip.ParentId(0).Equal(parentCommit.Id()) {
+			return tip.Id().String(), ErrNoChanges
+		}
+	}
+	tree, err := c.Repository.LookupTree(treeID)
+	if err != nil {
+		return "", errors.Wrap(err, "failed looking up tree")
+	}
+	defer tree.Free()
+	oid, err := c.Repository.CreateCommit("", author, author, message, tree, parentCommit)
+	if err != nil {
+		return "", errors.Wrap(err, "failed creating commit")
+	}
+	reference, err := c.Repository.References.Create(ref, oid, true, message)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed moving %s", ref)
+	}
+	reference.Free()
+	return oid.String(), nil
+}
@@ -0,0 +1,74 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	git2go "github.com/libgit2/git2go/v29"
+)
+
+type testEntry struct {
+	contents string
+	mode     git2go.Filemode
+}
+
+//initTestRepo creates a repository in a temporary directory
+func initTestRepo(t *testing.T) (*Collection, func()) {
+	dir, err := ioutil.TempDir("", "git2consul-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, err := git2go.InitRepository(dir, false)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return &Collection{Repository: repo}, func() {
+		repo.Free()
+		os.RemoveAll(dir)
+	}
+}
+
+//testCommit commits a tree of top level entries on top of parents without moving any ref
+func testCommit(t *testing.T, c *Collection, message string, entries map[string]testEntry, parents ...*git2go.Oid) *git2go.Oid {
+	builder, err := c.TreeBuilder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer builder.Free()
+	for name, entry := range entries {
+		blob, err := c.CreateBlobFromBuffer([]byte(entry.contents))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := builder.Insert(name, blob, entry.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	treeID, err := builder.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := c.LookupTree(treeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tree.Free()
+	var parentCommits []*git2go.Commit
+	for _, parent := range parents {
+		commit, err := c.LookupCommit(parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer commit.Free()
+		parentCommits = append(parentCommits, commit)
+	}
+	author := &git2go.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	id, err := c.CreateCommit("", author, author, message, tree, parentCommits...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
@@ -18,6 +18,7 @@ type options struct {
 	username, password                                               string
 	publicKeyPath, privateKeyPath, passphrase, gitRSAFingerprintPath string
 	fingerPrint                                                      []byte
+	bare                                                             bool
 }
 
 //GitOptions to simplify function signuratures
@@ -63,6 +64,14 @@ func Password(password string) GitOptions {
 	}
 }
 
+//Bare clones the repository without a working tree
+func Bare(bare bool) GitOptions {
+	return func(o *options) error {
+		o.bare = bare
+		return nil
+	}
+}
+
 //PublicKeyPath sets publickey for repo
 func PublicKeyPath(path string) GitOptions {
 	return func(o *options) error {
@@ -205,10 +214,37 @@ func ByDate(date time.Time) FilterFunc {
 	}
 }
 
+//topoOptions changes how ByTopo walks the history
+type topoOptions struct {
+	since       *git2go.Oid
+	firstParent bool
+}
+
+//TopoOption to change the walk of ByTopo
+type TopoOption func(*topoOptions)
+
+//Since stops the walk at a commit instead of the first commit in the collection, only the ref is walked
+func Since(id *git2go.Oid) TopoOption {
+	return func(o *topoOptions) {
+		o.since = id
+	}
+}
+
+//FirstParent follows only the first parent of merges, leaving out the commits merged in from other branches
+func FirstParent() TopoOption {
+	return func(o *topoOptions) {
+		o.firstParent = true
+	}
+}
+
 //ByTopo sorts by topolgical order from the last commit in the collection
-func ByTopo() FilterFunc {
+func ByTopo(opts ...TopoOption) FilterFunc {
+	o := &topoOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
 	return func(c *Collection) bool {
-		if c.Ref == nil || c.Commits == nil {
+		if c.Ref == nil || (o.since == nil && c.Commits == nil) || (o.since != nil && o.since.IsZero()) {
 			logrus.WithField("commits", len(c.Commits)).Warning("did not find any refs or list of commits")
 			return false
 		}
@@ -218,15 +254,27 @@ func ByTopo() FilterFunc {
 			logrus.WithError(err).Warning("failed to walk the repo")
 			return false
 		}
+		defer revWalk.Free()
 
-		if err := revWalk.PushGlob("*"); err != nil {
-			logrus.WithError(err).Warning("failed to push glob")
-			return false
+		if o.since == nil {
+			if err := revWalk.PushGlob("*"); err != nil {
+				logrus.WithError(err).Warning("failed to push glob")
+				return false
+			}
 		}
 		if err := revWalk.Push(c.Ref.Target()); err != nil {
 			logrus.WithError(err).Warning("failed pushing git reference")
 		}
+		if o.since != nil {
+			if err := revWalk.Hide(o.since); err != nil {
+				logrus.WithError(err).WithField("id", o.since).Warning("failed hiding commit")
+				return false
+			}
+		}
 		revWalk.Sorting(git2go.SortTopological)
+		if o.firstParent {
+			revWalk.SimplifyFirstParent()
+		}
 		id := &(git2go.Oid{})
 		for revWalk.Next(id) == nil {
 			commit, err := c.Repository.LookupCommit(id)
@@ -234,7 +282,7 @@ func ByTopo() FilterFunc {
 				logrus.WithError(err).WithFields(logrus.Fields{"id": id}).Warning("failed finding commit")
 				continue
 			}
-			if commit.Id().Equal(c.Commits[0].AsObject().Id()) {
+			if o.since == nil && commit.Id().Equal(c.Commits[0].AsObject().Id()) {
 				break
 			}
 			c.Commits = append(c.Commits, commit)
@@ -0,0 +1,36 @@
+package git
+
+import (
+	"testing"
+
+	git2go "github.com/libgit2/git2go/v29"
+)
+
+func TestCommitsSinceSkipsMergedCommits(t *testing.T) {
+	c, cleanup := initTestRepo(t)
+	defer cleanup()
+	base := testCommit(t, c, "base", map[string]testEntry{"a": {"1", git2go.FilemodeBlob}})
+	side := testCommit(t, c, "side", map[string]testEntry{"a": {"1", git2go.FilemodeBlob}, "b": {"2", git2go.FilemodeBlob}}, base)
+	mainline := testCommit(t, c, "main", map[string]testEntry{"a": {"3", git2go.FilemodeBlob}}, base)
+	merge := testCommit(t, c, "merge", map[string]testEntry{"a": {"3", git2go.FilemodeBlob}, "b": {"2", git2go.FilemodeBlob}}, mainline, side)
+	ref, err := c.References.Create("refs/heads/main", merge, true, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref.Free()
+
+	commits, err := c.CommitsSince("main", base.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, commit := range commits {
+		ids = append(ids, commit.ID)
+	}
+	if len(ids) != 2 || ids[0] != mainline.String() || ids[1] != merge.String() {
+		t.Errorf("expected the first parents %s and %s oldest first, got %v", mainline, merge, ids)
+	}
+	if len(commits) > 0 && commits[0].Message != "main" {
+		t.Errorf("expected the summary of the first commit, got %q", commits[0].Message)
+	}
+}
@@ -0,0 +1,137 @@
+package git
+
+import (
+	"time"
+
+	git2go "github.com/libgit2/git2go/v29"
+	"github.com/pkg/errors"
+)
+
+//TreeFile is a regular file of a commit tree
+type TreeFile struct {
+	// Path of the file in the tree
+	Path string
+	// ID of the blob holding the contents
+	ID string
+}
+
+//Files lists the regular files of a revision from the object database, symlinks and submodules are left out
+func (c *Collection) Files(revision string) ([]*TreeFile, error) {
+	tree, err := c.revisionTree(revision)
+	if err != nil {
+		return nil, err
+	}
+	defer tree.Free()
+	var files []*TreeFile
+	err = tree.Walk(func(root string, entry *git2go.TreeEntry) int {
+		if entry.Type == git2go.ObjectBlob && isFileMode(uint16(entry.Filemode)) {
+			files = append(files, &TreeFile{Path: root + entry.Name, ID: entry.Id.String()})
+		}
+		return 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+//IsBare tells whether the repository has no working tree
+func (c *Collection) IsBare() bool {
+	return c.Repository.IsBare()
+}
+
+//CommitInfo describes a commit
+type CommitInfo struct {
+	ID      string
+	Author  string
+	Message string
+	When    time.Time
+}
+
+//CommitsSince lists the commits of a branch that descend from a commit along the first parents, oldest first.
+//The commits are listed through the ByBranch and ByTopo filters on a fresh collection so the one in use is
+//left alone
+func (c *Collection) CommitsSince(branch, from string) ([]*CommitInfo, error) {
+	oid, err := git2go.NewOid(from)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed parsing commit %s", from)
+	}
+	walk := &Collection{Repository: c.Repository}
+	if !ByBranch(branch)(walk) || !ByTopo(Since(oid), FirstParent())(walk) {
+		return nil, errors.Errorf("failed listing the commits of %s since %s", branch, from)
+	}
+	commits := make([]*CommitInfo, len(walk.Commits))
+	for i, commit := range walk.Commits {
+		// the walk lists the newest commit first
+		commits[len(commits)-1-i] = commitInfo(commit)
+		commit.Free()
+	}
+	return commits, nil
+}
+
+//CommitsBetween lists every commit reachable from to but not from from, oldest first. Unlike CommitsSince
+//the commits of merged branches are listed too
+func (c *Collection) CommitsBetween(from, to string) ([]*CommitInfo, error) {
+	fromID, err := git2go.NewOid(from)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed parsing commit %s", from)
+	}
+	toID, err := git2go.NewOid(to)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed parsing commit %s", to)
+	}
+	revWalk, err := c.Repository.Walk()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to walk the repo")
+	}
+	defer revWalk.Free()
+	if err := revWalk.Push(toID); err != nil {
+		return nil, errors.Wrapf(err, "failed pushing commit %s", to)
+	}
+	if err := revWalk.Hide(fromID); err != nil {
+		return nil, errors.Wrapf(err, "failed hiding commit %s", from)
+	}
+	revWalk.Sorting(git2go.SortTopological | git2go.SortReverse)
+	var commits []*CommitInfo
+	id := &(git2go.Oid{})
+	for revWalk.Next(id) == nil {
+		commit, err := c.Repository.LookupCommit(id)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed looking up commit %s", id)
+		}
+		commits = append(commits, commitInfo(commit))
+		commit.Free()
+	}
+	return commits, nil
+}
+
+func commitInfo(commit *git2go.Commit) *CommitInfo {
+	author := commit.Author()
+	return &CommitInfo{
+		ID:      commit.Id().String(),
+		Author:  author.Name + " <" + author.Email + ">",
+		Message: commit.Summary(),
+		When:    author.When.UTC(),
+	}
+}
+
+//CommitSignature returns the signature of a commit and the data it signs, both are empty for unsigned commits
+func (c *Collection) CommitSignature(commitSha string) (string, string, error) {
+	oid, err := git2go.NewOid(commitSha)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed parsing commit %s", commitSha)
+	}
+	commit, err := c.Repository.LookupCommit(oid)
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed looking up commit %s", commitSha)
+	}
+	defer commit.Free()
+	signature, signed, err := commit.ExtractSignature()
+	if git2go.IsErrorCode(err, git2go.ErrNotFound) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed extracting the signature of %s", commitSha)
+	}
+	return signature, signed, nil
+}
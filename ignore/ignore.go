@@ -0,0 +1,174 @@
+package ignore
+
+import (
+	"bufio"
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+//rule is a single pattern of an ignore file
+type rule struct {
+	pattern string
+	regex   *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+//Matcher matches paths against patterns in gitignore syntax
+type Matcher struct {
+	rules []*rule
+}
+
+//Parse reads patterns in gitignore syntax, one per line
+func Parse(data []byte) *Matcher {
+	var patterns []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+	return New(patterns...)
+}
+
+//New returns a matcher for patterns in gitignore syntax, blank patterns and comments are skipped
+func New(patterns ...string) *Matcher {
+	m := &Matcher{}
+	for _, pattern := range patterns {
+		if r := parseRule(pattern); r != nil {
+			m.rules = append(m.rules, r)
+		}
+	}
+	return m
+}
+
+func parseRule(pattern string) *rule {
+	pattern = strings.TrimSuffix(pattern, "\r")
+	pattern = trimTrailingSpaces(pattern)
+	if pattern == "" || pattern[0] == '#' {
+		return nil
+	}
+	r := &rule{pattern: pattern}
+	switch {
+	case pattern[0] == '!':
+		r.negate = true
+		pattern = pattern[1:]
+	case strings.HasPrefix(pattern, `\!`), strings.HasPrefix(pattern, `\#`):
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		r.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return nil
+	}
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	var expr strings.Builder
+	expr.WriteString("^")
+	if !anchored {
+		expr.WriteString("(?:.*/)?")
+	}
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		if segment == "**" {
+			switch {
+			case last && i == 0:
+				expr.WriteString(".*")
+			case last:
+				// a/** matches everything inside a
+				expr.WriteString("/.*")
+			case i == 0:
+				expr.WriteString("(?:.*/)?")
+			default:
+				expr.WriteString("/(?:.*/)?")
+			}
+			continue
+		}
+		if i > 0 && segments[i-1] != "**" {
+			expr.WriteString("/")
+		}
+		expr.WriteString(globRegex(segment))
+	}
+	expr.WriteString("$")
+	regex, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil
+	}
+	r.regex = regex
+	return r
+}
+
+//trimTrailingSpaces removes trailing spaces that are not escaped with a backslash
+func trimTrailingSpaces(pattern string) string {
+	for strings.HasSuffix(pattern, " ") && !strings.HasSuffix(pattern, `\ `) {
+		pattern = pattern[:len(pattern)-1]
+	}
+	return pattern
+}
+
+//globRegex converts a glob of a single path segment into a regular expression
+func globRegex(glob string) string {
+	var expr strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			expr.WriteString("[^/]*")
+		case '?':
+			expr.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				expr.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(glob) {
+				i++
+				expr.WriteString(regexp.QuoteMeta(string(glob[i])))
+			}
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return expr.String()
+}
+
+//Match tells whether a slash separated path relative to the root is matched. Like git a path inside
+//a matched directory is matched as well
+func (m *Matcher) Match(path string, isDir bool) bool {
+	path = strings.Trim(path, "/")
+	segments := strings.Split(path, "/")
+	for i := 1; i < len(segments); i++ {
+		if m.match(strings.Join(segments[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.match(path, isDir)
+}
+
+//match applies the rules to a single path, the last matching rule decides
+func (m *Matcher) match(path string, isDir bool) bool {
+	matched := false
+	for _, r := range m.rules {
+		if r.dirOnly && !isDir {
+			continue
+		}
+		if r.regex.MatchString(path) {
+			matched = !r.negate
+		}
+	}
+	return matched
+}
+
+//Empty tells whether the matcher has no rules
+func (m *Matcher) Empty() bool {
+	return len(m.rules) == 0
+}
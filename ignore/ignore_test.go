@@ -0,0 +1,76 @@
+package ignore
+
+import (
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	m := Parse([]byte(`# comment
+*.md
+!CHANGELOG.md
+/build
+docs/
+ci/**/*.yml
+**/secrets
+a/**/b
+\#hash
+trailing   
+`))
+	cases := []struct {
+		path    string
+		isDir   bool
+		matched bool
+	}{
+		{"README.md", false, true},
+		{"config/README.md", false, true},
+		{"CHANGELOG.md", false, false},
+		{"build", false, true},
+		{"build/out", false, true},
+		{"app/build", false, false},
+		{"docs", false, false},
+		{"docs/index", false, true},
+		{"app/docs/index", false, true},
+		{"ci/pipeline.yml", false, true},
+		{"ci/jobs/test.yml", false, true},
+		{"ci/jobs/test.json", false, false},
+		{"secrets", false, true},
+		{"app/secrets/db", false, true},
+		{"a/b", false, true},
+		{"a/x/y/b", false, true},
+		{"#hash", false, true},
+		{"trailing", false, true},
+		{"config/app.json", false, false},
+	}
+	for _, c := range cases {
+		if got := m.Match(c.path, c.isDir); got != c.matched {
+			t.Errorf("%s expected %t got %t", c.path, c.matched, got)
+		}
+	}
+}
+
+func TestNegatedParent(t *testing.T) {
+	m := New("config/", "!config/app.json")
+	if !m.Match("config/app.json", false) {
+		t.Error("a file inside an ignored directory can not be included again")
+	}
+}
+
+func TestGlobs(t *testing.T) {
+	m := New("env/*", "[a-c]?.txt", "file[!0-9]")
+	for path, matched := range map[string]bool{
+		"env/dev":   true,
+		"env/a/b":   true,
+		"ab.txt":    true,
+		"dz.txt":    false,
+		"filex":     true,
+		"file1":     false,
+		"other/env": false,
+	} {
+		if got := m.Match(path, false); got != matched {
+			t.Errorf("%s expected %t got %t", path, matched, got)
+		}
+	}
+	if !New().Empty() {
+		t.Error("expected a matcher without patterns to be empty")
+	}
+}
@@ -0,0 +1,63 @@
+//Package normalize prepares file contents before they are written to consul as values
+package normalize
+
+import (
+	"bytes"
+	"encoding/base64"
+)
+
+const (
+	//Raw writes contents as they are
+	Raw = "raw"
+	//Trim removes leading and trailing white space
+	Trim = "trim"
+	//TrimTrailingNewline removes the newlines at the end
+	TrimTrailingNewline = "trim-trailing-newline"
+	//CRLF turns windows line endings into unix ones
+	CRLF = "crlf"
+	//Base64 encodes binary contents in base64 and writes text as it is
+	Base64 = "base64"
+)
+
+//binarySniffLen is how much of the contents is searched for a NUL byte, the same as git
+const binarySniffLen = 8000
+
+//Valid tells whether a policy is known
+func Valid(policy string) bool {
+	switch policy {
+	case Raw, Trim, TrimTrailingNewline, CRLF, Base64:
+		return true
+	}
+	return false
+}
+
+//IsBinary tells whether contents are binary, like git they are when a NUL byte is found at the start
+func IsBinary(contents []byte) bool {
+	if len(contents) > binarySniffLen {
+		contents = contents[:binarySniffLen]
+	}
+	return bytes.IndexByte(contents, 0) >= 0
+}
+
+//Apply normalizes contents with a policy. Binary contents are never changed as text, they are written
+//as they are unless the policy is base64. binary is what git knows about the contents, when it is not
+//set the contents are searched for a NUL byte
+func Apply(policy string, contents []byte, binary bool) []byte {
+	if binary || IsBinary(contents) {
+		if policy != Base64 {
+			return contents
+		}
+		encoded := make([]byte, base64.StdEncoding.EncodedLen(len(contents)))
+		base64.StdEncoding.Encode(encoded, contents)
+		return encoded
+	}
+	switch policy {
+	case Trim:
+		return bytes.TrimSpace(contents)
+	case TrimTrailingNewline:
+		return bytes.TrimRight(contents, "\r\n")
+	case CRLF:
+		return bytes.Replace(contents, []byte("\r\n"), []byte("\n"), -1)
+	}
+	return contents
+}
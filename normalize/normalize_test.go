@@ -0,0 +1,35 @@
+package normalize
+
+import (
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	pem := "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n"
+	tests := []struct {
+		policy   string
+		contents string
+		binary   bool
+		expected string
+	}{
+		{Raw, " value\n", false, " value\n"},
+		{Trim, " value\n", false, "value"},
+		{TrimTrailingNewline, " value\r\n\n", false, " value"},
+		{CRLF, "a\r\nb\r\n", false, "a\nb\n"},
+		{Base64, pem, false, pem},
+		{Base64, "\x00\x01", false, "AAE="},
+		{Base64, "gif", true, "Z2lm"},
+		{Trim, " \x00 ", false, " \x00 "},
+	}
+	for _, test := range tests {
+		if actual := string(Apply(test.policy, []byte(test.contents), test.binary)); actual != test.expected {
+			t.Errorf("%s of %q: expected %q, got %q", test.policy, test.contents, test.expected, actual)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	if !Valid(TrimTrailingNewline) || Valid("strip") {
+		t.Error("unexpected policy validation")
+	}
+}
@@ -0,0 +1,98 @@
+package semver
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var versionRegex = regexp.MustCompile(`v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-([0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*))?(?:\+[0-9A-Za-z-]+(?:\.[0-9A-Za-z-]+)*)?$`)
+
+//Version is a semantic version
+type Version struct {
+	Major, Minor, Patch int
+	// Prerelease identifiers such as rc.1, empty for a release
+	Prerelease string
+}
+
+//Parse finds the semantic version a tag such as config-v1.4.2 ends with
+func Parse(tag string) (*Version, bool) {
+	match := versionRegex.FindStringSubmatch(tag)
+	if match == nil {
+		return nil, false
+	}
+	v := &Version{Prerelease: match[4]}
+	var err error
+	for i, part := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		if *part, err = strconv.Atoi(match[i+1]); err != nil {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+//Compare returns -1, 0 or 1 when v is lower, equal or higher than other following semver precedence
+func (v *Version) Compare(other *Version) int {
+	for _, pair := range [][2]int{{v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if c := compareInt(pair[0], pair[1]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case v.Prerelease == other.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case other.Prerelease == "":
+		return -1
+	}
+	a, b := strings.Split(v.Prerelease, "."), strings.Split(other.Prerelease, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareIdentifier(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return compareInt(len(a), len(b))
+}
+
+//compareIdentifier orders numeric identifiers numerically and below alphanumeric ones
+func compareIdentifier(a, b string) int {
+	x, errA := strconv.Atoi(a)
+	y, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return compareInt(x, y)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+//Highest returns the tag with the highest version, tags without a version are ignored and
+//prereleases only count when prerelease is set
+func Highest(tags []string, prerelease bool) (string, bool) {
+	var highest string
+	var highestVersion *Version
+	for _, tag := range tags {
+		v, ok := Parse(tag)
+		if !ok || (v.Prerelease != "" && !prerelease) {
+			continue
+		}
+		if highestVersion == nil || v.Compare(highestVersion) > 0 {
+			highest, highestVersion = tag, v
+		}
+	}
+	return highest, highestVersion != nil
+}
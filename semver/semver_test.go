@@ -0,0 +1,43 @@
+package semver
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	v, ok := Parse("config-v1.4.2")
+	if !ok || v.Major != 1 || v.Minor != 4 || v.Patch != 2 || v.Prerelease != "" {
+		t.Errorf("unexpected version %+v", v)
+	}
+	v, ok = Parse("2.0.0-rc.1+build.5")
+	if !ok || v.Major != 2 || v.Prerelease != "rc.1" {
+		t.Errorf("unexpected version %+v", v)
+	}
+	if _, ok := Parse("config-latest"); ok {
+		t.Error("expected a tag without a version not to parse")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.10.0", "2.0.0"}
+	for i := 0; i < len(ordered)-1; i++ {
+		a, _ := Parse(ordered[i])
+		b, _ := Parse(ordered[i+1])
+		if a.Compare(b) != -1 || b.Compare(a) != 1 {
+			t.Errorf("expected %s < %s", ordered[i], ordered[i+1])
+		}
+	}
+}
+
+func TestHighest(t *testing.T) {
+	tags := []string{"config-v1.4.2", "config-v1.10.0", "config-v2.0.0-rc.1", "config-latest"}
+	if tag, ok := Highest(tags, false); !ok || tag != "config-v1.10.0" {
+		t.Errorf("expected config-v1.10.0, got %s", tag)
+	}
+	if tag, ok := Highest(tags, true); !ok || tag != "config-v2.0.0-rc.1" {
+		t.Errorf("expected config-v2.0.0-rc.1, got %s", tag)
+	}
+	if _, ok := Highest([]string{"latest"}, false); ok {
+		t.Error("expected no tag")
+	}
+}
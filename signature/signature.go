@@ -0,0 +1,215 @@
+//Package signature verifies the GPG and SSH signatures of git commits
+package signature
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"hash"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/openpgp"
+	pgperrors "golang.org/x/crypto/openpgp/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	//ErrUnsigned is returned for commits without a signature
+	ErrUnsigned = errors.New("commit is not signed")
+	//ErrUntrusted is returned for signatures made by a key that is not in the keyring or allowed signers
+	ErrUntrusted = errors.New("commit is signed by an untrusted key")
+)
+
+//sshNamespace is the namespace git signs commits in
+const sshNamespace = "git"
+
+//sshMagic starts ssh signatures and the data they sign
+const sshMagic = "SSHSIG"
+
+//Verifier checks signatures against a GPG keyring and an SSH allowed signers file
+type Verifier struct {
+	keyring openpgp.EntityList
+	signers []*AllowedSigner
+}
+
+//AllowedSigner is a line of an allowed signers file
+type AllowedSigner struct {
+	Principals []string
+	Key        ssh.PublicKey
+	// Namespaces the key may sign in, every namespace when empty
+	Namespaces []string
+}
+
+//Load reads an armored or binary GPG keyring and an SSH allowed signers file, either path may be empty
+func Load(keyringPath, allowedSignersPath string) (*Verifier, error) {
+	v := &Verifier{}
+	if keyringPath != "" {
+		data, err := ioutil.ReadFile(keyringPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed reading gpg keyring")
+		}
+		if v.keyring, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data)); err != nil {
+			if v.keyring, err = openpgp.ReadKeyRing(bytes.NewReader(data)); err != nil {
+				return nil, errors.Wrapf(err, "failed parsing gpg keyring %s", keyringPath)
+			}
+		}
+	}
+	if allowedSignersPath != "" {
+		data, err := ioutil.ReadFile(allowedSignersPath)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed reading allowed signers")
+		}
+		if v.signers, err = ParseAllowedSigners(data); err != nil {
+			return nil, errors.Wrapf(err, "failed parsing allowed signers %s", allowedSignersPath)
+		}
+	}
+	return v, nil
+}
+
+//ParseAllowedSigners reads an allowed signers file in the format of ssh-keygen: principals, options and a public key per line
+func ParseAllowedSigners(data []byte) ([]*AllowedSigner, error) {
+	var signers []*AllowedSigner
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			return nil, errors.Errorf("line %d needs principals and a public key", line)
+		}
+		key, _, options, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(strings.TrimPrefix(text, fields[0]))))
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+		signer := &AllowedSigner{Principals: strings.Split(fields[0], ","), Key: key}
+		for _, option := range options {
+			if strings.HasPrefix(strings.ToLower(option), "namespaces=") {
+				namespaces := strings.Trim(option[len("namespaces="):], `"`)
+				signer.Namespaces = strings.Split(namespaces, ",")
+			}
+		}
+		signers = append(signers, signer)
+	}
+	return signers, scanner.Err()
+}
+
+//Verify checks a signature of signed data and returns who made it. Armored PGP signatures are checked
+//against the keyring and SSH signatures against the allowed signers
+func (v *Verifier) Verify(signature, signed []byte) (string, error) {
+	switch {
+	case len(bytes.TrimSpace(signature)) == 0:
+		return "", ErrUnsigned
+	case bytes.HasPrefix(bytes.TrimSpace(signature), []byte("-----BEGIN SSH SIGNATURE-----")):
+		return v.verifySSH(signature, signed)
+	}
+	return v.verifyGPG(signature, signed)
+}
+
+func (v *Verifier) verifyGPG(signature, signed []byte) (string, error) {
+	if len(v.keyring) == 0 {
+		return "", ErrUntrusted
+	}
+	signer, err := openpgp.CheckArmoredDetachedSignature(v.keyring, bytes.NewReader(signed), bytes.NewReader(signature))
+	if err != nil {
+		if errors.Cause(err) == pgperrors.ErrUnknownIssuer {
+			return "", ErrUntrusted
+		}
+		return "", errors.Wrap(err, "invalid gpg signature")
+	}
+	var names []string
+	for name := range signer.Identities {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return signer.PrimaryKey.KeyIdString(), nil
+	}
+	sort.Strings(names)
+	return names[0], nil
+}
+
+//sshSignature is the blob of an armored ssh signature after the magic
+type sshSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+//sshSigned is what an ssh signature signs after the magic
+type sshSigned struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+func (v *Verifier) verifySSH(signature, signed []byte) (string, error) {
+	block, _ := pem.Decode(bytes.TrimSpace(signature))
+	if block == nil || block.Type != "SSH SIGNATURE" || !bytes.HasPrefix(block.Bytes, []byte(sshMagic)) {
+		return "", errors.New("invalid ssh signature armor")
+	}
+	var sig sshSignature
+	if err := ssh.Unmarshal(block.Bytes[len(sshMagic):], &sig); err != nil {
+		return "", errors.Wrap(err, "invalid ssh signature")
+	}
+	if sig.Version != 1 {
+		return "", errors.Errorf("unsupported ssh signature version %d", sig.Version)
+	}
+	if sig.Namespace != sshNamespace {
+		return "", errors.Errorf("ssh signature is made for namespace %q instead of %q", sig.Namespace, sshNamespace)
+	}
+	key, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid ssh signature key")
+	}
+	signer := v.allowed(key)
+	if signer == nil {
+		return "", ErrUntrusted
+	}
+	var h hash.Hash
+	switch sig.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return "", errors.Errorf("unsupported ssh signature hash %q", sig.HashAlgorithm)
+	}
+	h.Write(signed)
+	message := append([]byte(sshMagic), ssh.Marshal(sshSigned{sig.Namespace, sig.Reserved, sig.HashAlgorithm, h.Sum(nil)})...)
+	var blob ssh.Signature
+	if err := ssh.Unmarshal(sig.Signature, &blob); err != nil {
+		return "", errors.Wrap(err, "invalid ssh signature")
+	}
+	if err := key.Verify(message, &blob); err != nil {
+		return "", errors.Wrap(err, "invalid ssh signature")
+	}
+	return strings.Join(signer.Principals, ","), nil
+}
+
+//allowed returns the allowed signer of a key that may sign commits
+func (v *Verifier) allowed(key ssh.PublicKey) *AllowedSigner {
+	for _, signer := range v.signers {
+		if !bytes.Equal(signer.Key.Marshal(), key.Marshal()) {
+			continue
+		}
+		if len(signer.Namespaces) == 0 {
+			return signer
+		}
+		for _, namespace := range signer.Namespaces {
+			if namespace == sshNamespace {
+				return signer
+			}
+		}
+	}
+	return nil
+}
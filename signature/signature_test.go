@@ -0,0 +1,77 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/pem"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/ssh"
+)
+
+//signSSH signs data the way ssh-keygen -Y sign does for git
+func signSSH(t *testing.T, key ed25519.PrivateKey, namespace string, data []byte) []byte {
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := sha512.Sum512(data)
+	message := append([]byte(sshMagic), ssh.Marshal(sshSigned{namespace, "", "sha512", h[:]})...)
+	sig, err := signer.Sign(rand.Reader, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := append([]byte(sshMagic), ssh.Marshal(sshSignature{1, signer.PublicKey().Marshal(), namespace, "", "sha512", ssh.Marshal(sig)})...)
+	return pem.EncodeToMemory(&pem.Block{Type: "SSH SIGNATURE", Bytes: blob})
+}
+
+func TestVerifySSH(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	key, _ := ssh.NewPublicKey(public)
+	signers, err := ParseAllowedSigners([]byte("# release keys\nops@example.com namespaces=\"git\" " + string(ssh.MarshalAuthorizedKey(key))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &Verifier{signers: signers}
+	data := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nrelease\n")
+	signer, err := v.Verify(signSSH(t, private, "git", data), data)
+	if err != nil || signer != "ops@example.com" {
+		t.Errorf("expected a good signature by ops@example.com, got %q %v", signer, err)
+	}
+	if _, err := v.Verify(signSSH(t, private, "git", data), append(data, '!')); err == nil {
+		t.Error("expected a signature of other data to fail")
+	}
+	if _, err := v.Verify(signSSH(t, private, "file", data), data); err == nil {
+		t.Error("expected a signature in another namespace to fail")
+	}
+	_, other, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := v.Verify(signSSH(t, other, "git", data), data); err != ErrUntrusted {
+		t.Errorf("expected an untrusted key, got %v", err)
+	}
+	if _, err := v.Verify(nil, data); err != ErrUnsigned {
+		t.Errorf("expected an unsigned commit, got %v", err)
+	}
+}
+
+func TestVerifyGPG(t *testing.T) {
+	entity, err := openpgp.NewEntity("Ops", "", "ops@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nrelease\n")
+	var sig bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&sig, entity, bytes.NewReader(data), nil); err != nil {
+		t.Fatal(err)
+	}
+	v := &Verifier{keyring: openpgp.EntityList{entity}}
+	if signer, err := v.Verify(sig.Bytes(), data); err != nil || signer != "Ops <ops@example.com>" {
+		t.Errorf("expected a good signature by Ops, got %q %v", signer, err)
+	}
+	stranger, _ := openpgp.NewEntity("Stranger", "", "stranger@example.com", nil)
+	if _, err := (&Verifier{keyring: openpgp.EntityList{stranger}}).Verify(sig.Bytes(), data); err != ErrUntrusted {
+		t.Errorf("expected an untrusted key, got %v", err)
+	}
+}
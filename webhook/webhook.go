@@ -0,0 +1,212 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+//maxPayload bounds the size of a webhook request body
+const maxPayload = 25 << 20
+
+//Push is a push event received from a git host
+type Push struct {
+	// Provider that sent the event
+	Provider string
+	// Refs that were updated such as refs/heads/master
+	Refs []string
+	// Repository names and clone urls of the pushed repository
+	Repository []string
+}
+
+//HasBranch tells whether the push updated a branch
+func (p *Push) HasBranch(branch string) bool {
+	for _, ref := range p.Refs {
+		if ref == "refs/heads/"+branch {
+			return true
+		}
+	}
+	return false
+}
+
+//Handler receives push webhooks from GitHub, GitLab, Gitea and Bitbucket
+type Handler struct {
+	secret []byte
+	onPush func(*Push)
+}
+
+//New returns a webhook handler that verifies requests with secret and calls onPush for every push
+func New(secret string, onPush func(*Push)) *Handler {
+	return &Handler{secret: []byte(secret), onPush: onPush}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxPayload))
+	if err != nil {
+		http.Error(w, "failed reading body", http.StatusBadRequest)
+		return
+	}
+	provider, event := detect(r.Header)
+	if provider == "" {
+		http.Error(w, "unknown webhook provider", http.StatusBadRequest)
+		return
+	}
+	if err := h.verify(provider, r.Header, body); err != nil {
+		logrus.WithError(err).WithField("provider", provider).Warning("rejected webhook")
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if !isPush(provider, event) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	push, err := parse(provider, body)
+	if err != nil {
+		logrus.WithError(err).WithField("provider", provider).Warning("failed parsing webhook payload")
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	logrus.WithFields(logrus.Fields{
+		"provider": provider,
+		"refs":     push.Refs,
+	}).Debug("received push webhook")
+	h.onPush(push)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+//detect returns the provider and event of a request from its headers, gitea also sends github headers so it goes first
+func detect(header http.Header) (string, string) {
+	switch {
+	case header.Get("X-Gitea-Event") != "":
+		return "gitea", header.Get("X-Gitea-Event")
+	case header.Get("X-GitHub-Event") != "":
+		return "github", header.Get("X-GitHub-Event")
+	case header.Get("X-Gitlab-Event") != "":
+		return "gitlab", header.Get("X-Gitlab-Event")
+	case header.Get("X-Event-Key") != "":
+		return "bitbucket", header.Get("X-Event-Key")
+	}
+	return "", ""
+}
+
+func isPush(provider, event string) bool {
+	switch provider {
+	case "github", "gitea":
+		return event == "push"
+	case "gitlab":
+		return event == "Push Hook"
+	case "bitbucket":
+		return event == "repo:push" || event == "repo:refs_changed"
+	}
+	return false
+}
+
+//verify checks the request was sent with the shared secret. GitLab sends the secret as a token,
+//the others sign the body with an hmac
+func (h *Handler) verify(provider string, header http.Header, body []byte) error {
+	if len(h.secret) == 0 {
+		return errors.New("no webhook secret is configured")
+	}
+	switch provider {
+	case "gitlab":
+		if subtle.ConstantTimeCompare([]byte(header.Get("X-Gitlab-Token")), h.secret) != 1 {
+			return errors.New("token does not match")
+		}
+		return nil
+	case "gitea":
+		return checkHMAC(sha256.New, h.secret, body, header.Get("X-Gitea-Signature"))
+	}
+	if signature := header.Get("X-Hub-Signature-256"); signature != "" {
+		return checkHMAC(sha256.New, h.secret, body, strings.TrimPrefix(signature, "sha256="))
+	}
+	signature := header.Get("X-Hub-Signature")
+	switch {
+	case strings.HasPrefix(signature, "sha256="):
+		return checkHMAC(sha256.New, h.secret, body, strings.TrimPrefix(signature, "sha256="))
+	case strings.HasPrefix(signature, "sha1="):
+		return checkHMAC(sha1.New, h.secret, body, strings.TrimPrefix(signature, "sha1="))
+	}
+	return errors.New("request is not signed")
+}
+
+func checkHMAC(fn func() hash.Hash, secret, body []byte, signature string) error {
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return errors.Wrap(err, "failed decoding signature")
+	}
+	mac := hmac.New(fn, secret)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return errors.New("signature does not match")
+	}
+	return nil
+}
+
+type payload struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		FullName  string `json:"full_name"`
+		CloneURL  string `json:"clone_url"`
+		SSHURL    string `json:"ssh_url"`
+		HTTPURL   string `json:"git_http_url"`
+		GitSSHURL string `json:"git_ssh_url"`
+	} `json:"repository"`
+	// bitbucket cloud
+	Push struct {
+		Changes []struct {
+			New *struct {
+				Type string `json:"type"`
+				Name string `json:"name"`
+			} `json:"new"`
+		} `json:"changes"`
+	} `json:"push"`
+	// bitbucket server
+	Changes []struct {
+		RefID string `json:"refId"`
+	} `json:"changes"`
+}
+
+func parse(provider string, body []byte) (*Push, error) {
+	p := payload{}
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, errors.Wrap(err, "failed decoding payload")
+	}
+	push := &Push{Provider: provider}
+	if p.Ref != "" {
+		push.Refs = append(push.Refs, p.Ref)
+	}
+	for _, change := range p.Push.Changes {
+		if change.New == nil {
+			continue
+		}
+		switch change.New.Type {
+		case "branch":
+			push.Refs = append(push.Refs, "refs/heads/"+change.New.Name)
+		case "tag", "annotated_tag":
+			push.Refs = append(push.Refs, "refs/tags/"+change.New.Name)
+		}
+	}
+	for _, change := range p.Changes {
+		push.Refs = append(push.Refs, change.RefID)
+	}
+	for _, name := range []string{p.Repository.FullName, p.Repository.CloneURL, p.Repository.SSHURL, p.Repository.HTTPURL, p.Repository.GitSSHURL} {
+		if name != "" {
+			push.Repository = append(push.Repository, name)
+		}
+	}
+	return push, nil
+}
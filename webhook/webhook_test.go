@@ -0,0 +1,79 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testSecret = "s3cret"
+
+func sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func serve(headers map[string]string, body []byte) (*Push, int) {
+	var received *Push
+	handler := New(testSecret, func(p *Push) { received = p })
+	req := httptest.NewRequest(http.MethodPost, "/webhook", bytes.NewReader(body))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return received, rec.Code
+}
+
+func TestGitHubPush(t *testing.T) {
+	body := []byte(`{"ref": "refs/heads/master", "repository": {"clone_url": "https://github.com/alleeclark/test-git2consul.git"}}`)
+	push, code := serve(map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign(body)}, body)
+	if code != http.StatusAccepted || push == nil || !push.HasBranch("master") {
+		t.Errorf("expected a push to master got %d %v", code, push)
+	}
+}
+
+func TestInvalidSignature(t *testing.T) {
+	body := []byte(`{"ref": "refs/heads/master"}`)
+	push, code := serve(map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign([]byte("other"))}, body)
+	if code != http.StatusUnauthorized || push != nil {
+		t.Errorf("expected the push to be rejected got %d", code)
+	}
+}
+
+func TestGitLabToken(t *testing.T) {
+	body := []byte(`{"ref": "refs/heads/facts"}`)
+	push, code := serve(map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": testSecret}, body)
+	if code != http.StatusAccepted || push == nil || !push.HasBranch("facts") {
+		t.Errorf("expected a push to facts got %d %v", code, push)
+	}
+}
+
+func TestGiteaPush(t *testing.T) {
+	body := []byte(`{"ref": "refs/heads/master"}`)
+	push, code := serve(map[string]string{"X-Gitea-Event": "push", "X-GitHub-Event": "push", "X-Gitea-Signature": sign(body)}, body)
+	if code != http.StatusAccepted || push == nil || push.Provider != "gitea" {
+		t.Errorf("expected a gitea push got %d %v", code, push)
+	}
+}
+
+func TestBitbucketPush(t *testing.T) {
+	body := []byte(`{"push": {"changes": [{"new": {"type": "branch", "name": "master"}}]}}`)
+	push, code := serve(map[string]string{"X-Event-Key": "repo:push", "X-Hub-Signature": "sha256=" + sign(body)}, body)
+	if code != http.StatusAccepted || push == nil || !push.HasBranch("master") {
+		t.Errorf("expected a push to master got %d %v", code, push)
+	}
+}
+
+func TestPing(t *testing.T) {
+	body := []byte(`{"zen": "keep it logically awesome"}`)
+	push, code := serve(map[string]string{"X-GitHub-Event": "ping", "X-Hub-Signature-256": "sha256=" + sign(body)}, body)
+	if code != http.StatusNoContent || push != nil {
+		t.Errorf("expected ping to be acknowledged got %d", code)
+	}
+}